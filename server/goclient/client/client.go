@@ -0,0 +1,290 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"goserver/wsnet"
+)
+
+// ErrDisconnected 等待回应期间连接断开，请求可能已被服务端处理
+var ErrDisconnected = errors.New("client: disconnected before response")
+
+// Options 客户端配置，零值字段使用默认值
+type Options struct {
+	Timeout   time.Duration     // Request 的默认超时，ctx 未设置截止时间时生效，默认 10s
+	Codec     wsnet.Codec       // 负载编解码器，默认 JSON，个别 TypeID 可用 SetCodec 覆盖
+	Compress  bool              // 发送的负载是否压缩，服务端的回应与请求一致
+	EncType   wsnet.EncryptType // 发送的负载加密方式，默认不加密
+	Reconnect ReconnectOptions  // 断线重连配置
+}
+
+// result 回应负载或断线错误
+type result struct {
+	payload []byte
+	err     error
+}
+
+// PushHandler 服务端推送的处理函数，payload 可用 Client.Decode 反序列化。在读协程中执行，不应阻塞
+type PushHandler func(msgID uint32, payload []byte)
+
+/*
+Client 基于 WSClient 的消息客户端，供机器人、压测与工具使用。
+
+协议帧头中没有请求序号，服务端对同一连接的消息按顺序处理并回应，
+因此回应按 TypeID/MsgID 与等待中的请求先进先出匹配。服务端处理出错时不回应，
+对应的请求会超时，此时同一消息的后续回应可能错配，同一消息不宜在超时后立即重发
+
+	c := client.New("localhost:8080", client.Options{})
+	c.OnPush(msgdef.TypeSys, func(msgID uint32, payload []byte) {})
+	if err := c.Start(); err != nil {
+		return err
+	}
+	defer c.Close()
+
+	resp, err := client.Request[msgdef.EchoResp](ctx, c, msgdef.TypeSys, msgdef.MsgEcho, &msgdef.EchoReq{Text: "hi"})
+*/
+type Client struct {
+	ws     *WSClient
+	router *wsnet.Router // 只用于按 TypeID 选择编解码器
+	opts   Options
+
+	sendMu  sync.Mutex // 保证登记顺序与发送顺序一致
+	mu      sync.Mutex
+	pending map[uint32][]chan result
+	pushes  map[uint32]PushHandler
+	onState StateCallback
+}
+
+// New 创建客户端（不会立即连接）
+func New(addr string, opts Options) *Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	c := &Client{
+		ws:      NewWSClient(addr, opts.Reconnect),
+		router:  wsnet.NewRouter(),
+		opts:    opts,
+		pending: make(map[uint32][]chan result),
+		pushes:  make(map[uint32]PushHandler),
+	}
+	if opts.Codec != nil {
+		c.router.SetDefaultCodec(opts.Codec)
+	}
+	c.ws.SetCallback(c.handleFrame)
+	c.ws.SetStateCallback(c.handleState)
+	return c
+}
+
+// Conn 底层连接
+func (c *Client) Conn() *WSClient {
+	return c.ws
+}
+
+// Start 建立连接，初次连接失败时返回错误
+func (c *Client) Start() error {
+	return c.ws.Start()
+}
+
+// Close 关闭连接并停止重连，不等待退出，需要等待时使用 Done()
+func (c *Client) Close() {
+	c.ws.Close()
+}
+
+// Done 客户端停止时关闭
+func (c *Client) Done() <-chan struct{} {
+	return c.ws.Done()
+}
+
+// OnState 设置连接状态回调，需在 Start 之前调用
+func (c *Client) OnState(cb StateCallback) {
+	c.onState = cb
+}
+
+// SetCodec 为某个 TypeID 指定编解码器，须与服务端一致
+func (c *Client) SetCodec(typeID uint32, codec wsnet.Codec) {
+	c.router.SetCodec(typeID, codec)
+}
+
+// Decode 按 TypeID 对应的编解码器反序列化负载
+func (c *Client) Decode(typeID uint32, payload []byte, v any) error {
+	return c.router.Codec(typeID).Unmarshal(payload, v)
+}
+
+// OnPush 注册某个 TypeID 的推送处理函数，同一 TypeID 重复注册时覆盖
+func (c *Client) OnPush(typeID uint32, h PushHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pushes[typeID&0x3FF] = h
+}
+
+// Notify 以 MT_Notify 发送消息，服务端不回应。发送队列已满时等待，直到入队或 ctx 取消；未连接时返回 ErrNotConnected
+func (c *Client) Notify(ctx context.Context, typeID, msgID uint32, v any) error {
+	frame, err := c.encode(wsnet.MT_Notify, typeID, msgID, v)
+	if err != nil {
+		return err
+	}
+	return c.ws.Send(ctx, frame)
+}
+
+// Call 以 MT_Request 发送 req 并等待回应，回应反序列化到 resp（为 nil 时丢弃）。
+// ctx 未设置截止时间时使用 Options.Timeout；未连接时返回 ErrNotConnected，等待期间断线返回 ErrDisconnected，
+// 服务端处理失败时返回 *wsnet.Error，可用 errors.As 取出错误码
+func (c *Client) Call(ctx context.Context, typeID, msgID uint32, req, resp any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	frame, err := c.encode(wsnet.MT_Request, typeID, msgID, req)
+	if err != nil {
+		return err
+	}
+
+	// 先登记再发送，避免回应先于登记到达
+	key := routeKey(typeID, msgID)
+	ch := make(chan result, 1)
+	c.sendMu.Lock()
+	err = c.ws.sendFrame(ctx, frame, func() {
+		c.mu.Lock()
+		c.pending[key] = append(c.pending[key], ch)
+		c.mu.Unlock()
+	})
+	c.sendMu.Unlock()
+	if err != nil {
+		c.cancel(key, ch)
+		return err
+	}
+	select {
+	case res := <-ch:
+		if res.err != nil || resp == nil {
+			return res.err
+		}
+		return c.Decode(typeID, res.payload, resp)
+	case <-ctx.Done():
+		c.cancel(key, ch)
+		return ctx.Err()
+	}
+}
+
+/*
+Request 类型化的 Call，回应反序列化为 *R
+
+	resp, err := client.Request[msgdef.EchoResp](ctx, c, msgdef.TypeSys, msgdef.MsgEcho, &msgdef.EchoReq{Text: "hi"})
+*/
+func Request[R any](ctx context.Context, c *Client, typeID, msgID uint32, req any) (*R, error) {
+	resp := new(R)
+	if err := c.Call(ctx, typeID, msgID, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (c *Client) encode(mt wsnet.MessageType, typeID, msgID uint32, v any) ([]byte, error) {
+	payload, err := c.router.Codec(typeID).Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	id := wsnet.MessageID{MsgType: uint32(mt), EncType: uint32(c.opts.EncType), TypeID: typeID, MsgID: msgID}
+	if c.opts.Compress {
+		id.Compress = 1
+	}
+	return wsnet.EncodeFrame(id, payload)
+}
+
+// cancel 移除超时或发送失败的请求
+func (c *Client) cancel(key uint32, ch chan result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.pending[key]
+	for i, w := range waiters {
+		if w == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+	if len(waiters) == 0 {
+		delete(c.pending, key)
+	} else {
+		c.pending[key] = waiters
+	}
+}
+
+// resolve 把回应交给同一消息最早的等待者
+func (c *Client) resolve(id wsnet.MessageID, res result) {
+	key := routeKey(id.TypeID, id.MsgID)
+	c.mu.Lock()
+	waiters := c.pending[key]
+	var ch chan result
+	if len(waiters) > 0 {
+		ch = waiters[0]
+		if len(waiters) == 1 {
+			delete(c.pending, key)
+		} else {
+			c.pending[key] = waiters[1:]
+		}
+	}
+	c.mu.Unlock()
+	if ch == nil {
+		log.Printf("no pending request for response type %d msg %d", id.TypeID, id.MsgID)
+		return
+	}
+	ch <- res
+}
+
+func (c *Client) handleFrame(_ wsnet.IConnector, data []byte) {
+	id, payload, err := wsnet.DecodeFrame(data)
+	if err != nil {
+		log.Printf("decode frame err: %v", err)
+		return
+	}
+
+	switch wsnet.MessageType(id.MsgType) {
+	case wsnet.MT_Response:
+		c.resolve(id, result{payload: payload})
+	case wsnet.MT_Error:
+		e := new(wsnet.Error)
+		if err := json.Unmarshal(payload, e); err != nil {
+			log.Printf("decode error response type %d msg %d err: %v", id.TypeID, id.MsgID, err)
+			e = wsnet.NewError(wsnet.CodeInternal, "malformed error response")
+		}
+		c.resolve(id, result{err: e})
+	case wsnet.MT_Push:
+		c.mu.Lock()
+		h := c.pushes[id.TypeID]
+		c.mu.Unlock()
+		if h == nil {
+			log.Printf("no push handler for type %d msg %d", id.TypeID, id.MsgID)
+			return
+		}
+		h(id.MsgID, payload)
+	default:
+		log.Printf("unexpected message type %d from server", id.MsgType)
+	}
+}
+
+// handleState 连接断开时回应不会再到达，所有等待中的请求以 ErrDisconnected 返回
+func (c *Client) handleState(state State, err error) {
+	if state == StateDisconnected {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = make(map[uint32][]chan result)
+		c.mu.Unlock()
+		for _, waiters := range pending {
+			for _, ch := range waiters {
+				ch <- result{err: ErrDisconnected}
+			}
+		}
+	}
+	if c.onState != nil {
+		c.onState(state, err)
+	}
+}
+
+func routeKey(typeID, msgID uint32) uint32 {
+	return (typeID&0x3FF)<<13 | msgID&0x1FFF
+}
@@ -0,0 +1,295 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"goserver/msgdef"
+	"goserver/wsnet"
+)
+
+// testServer 接受客户端连接并交给测试直接读写帧
+type testServer struct {
+	*httptest.Server
+	conns chan *websocket.Conn
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	s := &testServer{conns: make(chan *websocket.Conn, 8)}
+	var upgrader websocket.Upgrader
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		s.conns <- conn
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testServer) addr() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// accept 等待客户端的下一个连接
+func (s *testServer) accept(t *testing.T) *websocket.Conn {
+	t.Helper()
+	select {
+	case conn := <-s.conns:
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	case <-time.After(2 * time.Second):
+		t.Fatal("no connection")
+		return nil
+	}
+}
+
+// readFrame 读取客户端发来的一帧
+func readFrame(t *testing.T, conn *websocket.Conn) (wsnet.MessageID, []byte) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	id, payload, err := wsnet.DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("decode frame: %v", err)
+	}
+	return id, payload
+}
+
+// writeFrame 以 JSON 负载向客户端写一帧
+func writeFrame(t *testing.T, conn *websocket.Conn, mt wsnet.MessageType, typeID, msgID uint32, v any) {
+	t.Helper()
+	payload, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := wsnet.EncodeFrame(wsnet.MessageID{MsgType: uint32(mt), TypeID: typeID, MsgID: msgID}, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatalf("write frame: %v", err)
+	}
+}
+
+// startClient 连接到 srv，返回客户端与服务端一侧的连接
+func startClient(t *testing.T, srv *testServer, opts Options) (*Client, *websocket.Conn) {
+	t.Helper()
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	c := New(srv.addr(), opts)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Close()
+		<-c.Done()
+	})
+	return c, srv.accept(t)
+}
+
+type echoResult struct {
+	resp *msgdef.EchoResp
+	err  error
+}
+
+// goEcho 在新协程中发起 Echo 请求
+func goEcho(c *Client, msgID uint32, text string) <-chan echoResult {
+	done := make(chan echoResult, 1)
+	go func() {
+		resp, err := Request[msgdef.EchoResp](context.Background(), c, msgdef.TypeSys, msgID, &msgdef.EchoReq{Text: text})
+		done <- echoResult{resp, err}
+	}()
+	return done
+}
+
+func wait(t *testing.T, done <-chan echoResult) echoResult {
+	t.Helper()
+	select {
+	case res := <-done:
+		return res
+	case <-time.After(3 * time.Second):
+		t.Fatal("call did not return")
+		return echoResult{}
+	}
+}
+
+func (c *Client) pendingLen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, waiters := range c.pending {
+		n += len(waiters)
+	}
+	return n
+}
+
+// TestCallFIFO 同一消息的回应按请求顺序匹配
+func TestCallFIFO(t *testing.T) {
+	srv := newTestServer(t)
+	c, conn := startClient(t, srv, Options{})
+
+	first := goEcho(c, msgdef.MsgEcho, "1")
+	id, payload := readFrame(t, conn)
+	if wsnet.MessageType(id.MsgType) != wsnet.MT_Request || id.TypeID != msgdef.TypeSys || id.MsgID != msgdef.MsgEcho {
+		t.Fatalf("frame id = %+v", id)
+	}
+	if string(payload) != `{"text":"1"}` {
+		t.Fatalf("payload = %s", payload)
+	}
+	second := goEcho(c, msgdef.MsgEcho, "2")
+	readFrame(t, conn)
+
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "r1"})
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "r2"})
+	if res := wait(t, first); res.err != nil || res.resp.Text != "r1" {
+		t.Fatalf("first = %+v, %v", res.resp, res.err)
+	}
+	if res := wait(t, second); res.err != nil || res.resp.Text != "r2" {
+		t.Fatalf("second = %+v, %v", res.resp, res.err)
+	}
+	if n := c.pendingLen(); n != 0 {
+		t.Fatalf("pending = %d, want 0", n)
+	}
+}
+
+// TestCallOutOfOrder 不同消息的回应乱序到达时各自匹配
+func TestCallOutOfOrder(t *testing.T) {
+	srv := newTestServer(t)
+	c, conn := startClient(t, srv, Options{})
+
+	a := goEcho(c, 100, "a")
+	readFrame(t, conn)
+	b := goEcho(c, 101, "b")
+	readFrame(t, conn)
+
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, 101, msgdef.EchoResp{Text: "rb"})
+	if res := wait(t, b); res.err != nil || res.resp.Text != "rb" {
+		t.Fatalf("b = %+v, %v", res.resp, res.err)
+	}
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, 100, msgdef.EchoResp{Text: "ra"})
+	if res := wait(t, a); res.err != nil || res.resp.Text != "ra" {
+		t.Fatalf("a = %+v, %v", res.resp, res.err)
+	}
+}
+
+// TestCallTimeout 没有回应的请求超时后移除，迟到的回应被丢弃而不是交给后续请求
+func TestCallTimeout(t *testing.T) {
+	srv := newTestServer(t)
+	c, conn := startClient(t, srv, Options{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Call(ctx, msgdef.TypeSys, msgdef.MsgEcho, &msgdef.EchoReq{Text: "lost"}, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	readFrame(t, conn)
+	if n := c.pendingLen(); n != 0 {
+		t.Fatalf("pending = %d after timeout, want 0", n)
+	}
+
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "late"})
+	// 借助一次推送确认迟到的回应已被处理
+	pushed := make(chan struct{})
+	c.OnPush(msgdef.TypeSys, func(uint32, []byte) { close(pushed) })
+	writeFrame(t, conn, wsnet.MT_Push, msgdef.TypeSys, msgdef.MsgKick, struct{}{})
+	<-pushed
+
+	next := goEcho(c, msgdef.MsgEcho, "next")
+	readFrame(t, conn)
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "fresh"})
+	if res := wait(t, next); res.err != nil || res.resp.Text != "fresh" {
+		t.Fatalf("next = %+v, %v", res.resp, res.err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	srv := newTestServer(t)
+	type push struct {
+		msgID uint32
+		text  string
+	}
+	got := make(chan push, 1)
+	c := New(srv.addr(), Options{})
+	c.OnPush(msgdef.TypeSys, func(msgID uint32, payload []byte) {
+		var resp msgdef.EchoResp
+		if err := c.Decode(msgdef.TypeSys, payload, &resp); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		got <- push{msgID, resp.Text}
+	})
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Close()
+		<-c.Done()
+	}()
+	conn := srv.accept(t)
+
+	// 没有处理函数的推送与意外的消息类型被忽略
+	writeFrame(t, conn, wsnet.MT_Push, 2, 1, struct{}{})
+	writeFrame(t, conn, wsnet.MT_Request, msgdef.TypeSys, 1, struct{}{})
+	writeFrame(t, conn, wsnet.MT_Push, msgdef.TypeSys, msgdef.MsgKick, msgdef.EchoResp{Text: "bye"})
+	select {
+	case p := <-got:
+		if p.msgID != msgdef.MsgKick || p.text != "bye" {
+			t.Fatalf("push = %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("push not dispatched")
+	}
+}
+
+// TestCallDisconnected 等待回应期间断线，请求以 ErrDisconnected 返回
+func TestCallDisconnected(t *testing.T) {
+	srv := newTestServer(t)
+	c, conn := startClient(t, srv, Options{Reconnect: ReconnectOptions{BackoffMin: time.Hour}})
+
+	done := goEcho(c, msgdef.MsgEcho, "hi")
+	readFrame(t, conn)
+	conn.Close()
+	if res := wait(t, done); !errors.Is(res.err, ErrDisconnected) {
+		t.Fatalf("err = %v, want ErrDisconnected", res.err)
+	}
+	if n := c.pendingLen(); n != 0 {
+		t.Fatalf("pending = %d, want 0", n)
+	}
+}
+
+// TestCallError MT_Error 回应以 *wsnet.Error 返回，并且只消费对应的请求
+func TestCallError(t *testing.T) {
+	srv := newTestServer(t)
+	c, conn := startClient(t, srv, Options{})
+
+	failed := goEcho(c, msgdef.MsgEcho, "1")
+	readFrame(t, conn)
+	next := goEcho(c, msgdef.MsgEcho, "2")
+	readFrame(t, conn)
+
+	writeFrame(t, conn, wsnet.MT_Error, msgdef.TypeSys, msgdef.MsgEcho, wsnet.NewError(100, "not enough coins"))
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "ok"})
+	var e *wsnet.Error
+	if res := wait(t, failed); !errors.As(res.err, &e) || e.Code != 100 || e.Msg != "not enough coins" {
+		t.Fatalf("err = %v, want wsnet error 100", res.err)
+	}
+	if res := wait(t, next); res.err != nil || res.resp.Text != "ok" {
+		t.Fatalf("next = %+v, %v", res.resp, res.err)
+	}
+}
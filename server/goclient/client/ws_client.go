@@ -0,0 +1,421 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"goserver/wsnet"
+)
+
+var (
+	ErrClosed          = errors.New("client: closed")
+	ErrStarted         = errors.New("client: already started")
+	ErrReconnectFailed = errors.New("client: reconnect attempts exhausted")
+	// ErrNotConnected 连接断开或正在重连，消息未入队
+	ErrNotConnected = errors.New("client: not connected")
+)
+
+const (
+	pongWait   = 30 * time.Second // 读取超时，收到任何消息或 Pong 时重置
+	pingPeriod = 10 * time.Second // 发送 Ping 的间隔，须小于 pongWait
+	writeWait  = 10 * time.Second // 单次写入超时
+)
+
+// State 连接状态
+type State int32
+
+const (
+	StateConnecting   State = iota // 正在连接（含重连）
+	StateConnected                 // 已连接
+	StateDisconnected              // 连接断开或连接失败
+)
+
+func (s State) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return "disconnected"
+	}
+}
+
+// StateCallback 连接状态变化时回调，err 为断开或连接失败的原因（主动关闭时为 nil）。
+// 在监控协程中执行，不应阻塞
+type StateCallback func(state State, err error)
+
+// ReconnectOptions 断线重连配置，零值字段使用默认值
+type ReconnectOptions struct {
+	BackoffMin  time.Duration // 首次重连前的等待时间，之后按 2 倍递增（带抖动），默认 500ms
+	BackoffMax  time.Duration // 重连等待时间上限，默认 30s
+	MaxAttempts int           // 连续重连失败的次数上限，达到后客户端停止，0 表示不限
+}
+
+/*
+WSClient 连接层，收发完整的帧（4 字节帧头 + 负载），实现 wsnet.IConnector。
+一般通过 Client 使用，需要直接处理帧时可单独使用。
+
+连接由唯一的监控协程持有：监控协程负责写入与心跳，读协程只负责读取，
+任一方出错时监控协程关闭连接、等待读协程退出后按指数退避重连。
+只有已连接时才接受发送；断线时发送队列中尚未写出的消息会被丢弃，
+避免重连后旧请求的回应与新请求错配
+*/
+type WSClient struct {
+	url      string
+	opts     ReconnectOptions
+	send     chan []byte // 发消息通道，元素为编码后的完整帧
+	callback wsnet.HandleCallback
+	onState  StateCallback
+	state    atomic.Int32
+
+	// sendMu 发送方持读锁检查状态并入队，监控协程持写锁切换连接状态并清空队列，
+	// 保证入队的消息只会写到入队时的连接上
+	sendMu sync.RWMutex
+	down   chan struct{} // 当前连接断开时关闭，唤醒因队列已满而等待的发送方
+
+	ctx     context.Context // Close 时取消
+	cancel  context.CancelFunc
+	stopped chan struct{} // 监控协程退出（或初次连接失败）时关闭
+
+	lifeMu  sync.Mutex
+	started bool
+
+	mu    sync.RWMutex
+	props map[string]any
+}
+
+func NewWSClient(addr string, opts ReconnectOptions) *WSClient {
+	if opts.BackoffMin <= 0 {
+		opts.BackoffMin = 500 * time.Millisecond
+	}
+	if opts.BackoffMax < opts.BackoffMin {
+		opts.BackoffMax = max(30*time.Second, opts.BackoffMin)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &WSClient{
+		url:     addr,
+		opts:    opts,
+		send:    make(chan []byte, 256), // 缓冲区
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+		props:   make(map[string]any),
+	}
+	c.state.Store(int32(StateDisconnected))
+	return c
+}
+
+// SetCallback 设置收到帧时的回调，需在 Start 之前调用。回调在读协程中执行，不应阻塞
+func (c *WSClient) SetCallback(cb wsnet.HandleCallback) {
+	c.callback = cb
+}
+
+// SetStateCallback 设置连接状态回调，需在 Start 之前调用
+func (c *WSClient) SetStateCallback(cb StateCallback) {
+	c.onState = cb
+}
+
+// State 当前连接状态
+func (c *WSClient) State() State {
+	return State(c.state.Load())
+}
+
+// Done 客户端停止（Close、重连次数耗尽或初次连接失败）时关闭
+func (c *WSClient) Done() <-chan struct{} {
+	return c.stopped
+}
+
+func (c *WSClient) setState(s State, err error) {
+	c.state.Store(int32(s))
+	if c.onState != nil {
+		c.onState(s, err)
+	}
+}
+
+// 连接 WebSocket
+func (c *WSClient) dial() (*websocket.Conn, error) {
+	u := url.URL{Scheme: "ws", Host: c.url, Path: "/ws"}
+	log.Printf("Connecting to %s", u.String())
+
+	conn, _, err := websocket.DefaultDialer.DialContext(c.ctx, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 设置超时
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	// 收到 Pong 重置超时
+	conn.SetPongHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	// 收到 Ping 回 Pong，WriteControl 可与写协程并发调用
+	conn.SetPingHandler(func(appData string) error {
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(writeWait))
+		if err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+			log.Println("发送 Pong 失败:", err)
+			return err
+		}
+		return nil
+	})
+	return conn, nil
+}
+
+// Start 建立连接并启动监控协程，返回 nil 后即可发送。初次连接失败时返回错误且客户端不可再用
+func (c *WSClient) Start() error {
+	c.lifeMu.Lock()
+	if c.started {
+		c.lifeMu.Unlock()
+		if c.ctx.Err() != nil {
+			return ErrClosed
+		}
+		return ErrStarted
+	}
+	c.started = true
+	c.lifeMu.Unlock()
+
+	c.setState(StateConnecting, nil)
+	conn, err := c.dial()
+	if err != nil {
+		c.setState(StateDisconnected, err)
+		c.cancel()
+		close(c.stopped)
+		return err
+	}
+	c.connected()
+	go c.run(conn)
+	return nil
+}
+
+// run 监控协程，持有连接直到 Close 或重连次数耗尽
+func (c *WSClient) run(conn *websocket.Conn) {
+	defer close(c.stopped)
+	defer c.cancel()
+
+	for {
+		err := c.serve(conn)
+		c.disconnected()
+		if c.ctx.Err() != nil {
+			c.setState(StateDisconnected, nil)
+			return
+		}
+		log.Println("连接断开:", err)
+		c.setState(StateDisconnected, err)
+
+		if conn = c.reconnect(); conn == nil {
+			return
+		}
+		c.connected()
+	}
+}
+
+// reconnect 按指数退避（带抖动）重连，Close 或次数耗尽时返回 nil
+func (c *WSClient) reconnect() *websocket.Conn {
+	backoff := c.opts.BackoffMin
+	for attempt := 1; ; attempt++ {
+		if c.opts.MaxAttempts > 0 && attempt > c.opts.MaxAttempts {
+			log.Printf("重连 %d 次失败，停止重连", c.opts.MaxAttempts)
+			// 先拒绝新的发送，再通知断开
+			c.cancel()
+			c.setState(StateDisconnected, ErrReconnectFailed)
+			return nil
+		}
+
+		// 抖动避免大量客户端在服务端重启后同时重连
+		wait := backoff/2 + rand.N(backoff/2+1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			c.setState(StateDisconnected, nil)
+			return nil
+		case <-timer.C:
+		}
+
+		log.Printf("尝试重连中... (第 %d 次)", attempt)
+		c.setState(StateConnecting, nil)
+		conn, err := c.dial()
+		if err == nil {
+			return conn
+		}
+		if c.ctx.Err() != nil {
+			c.setState(StateDisconnected, nil)
+			return nil
+		}
+		log.Println("重连失败:", err)
+		c.setState(StateDisconnected, err)
+		backoff = min(backoff*2, c.opts.BackoffMax)
+	}
+}
+
+// serve 在当前协程中写消息与发送心跳，直到连接出错或 Close，返回前关闭连接并等待读协程退出
+func (c *WSClient) serve(conn *websocket.Conn) error {
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- c.readLoop(conn)
+	}()
+
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	var err error
+	for err == nil {
+		select {
+		case message := <-c.send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			err = conn.WriteMessage(websocket.BinaryMessage, message)
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(writeWait))
+		case err = <-readErr:
+			conn.Close()
+			return err
+		case <-c.ctx.Done():
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+			conn.Close()
+			<-readErr
+			return nil
+		}
+	}
+	conn.Close()
+	<-readErr
+	return err
+}
+
+// 读取消息
+func (c *WSClient) readLoop(conn *websocket.Conn) error {
+	for {
+		mt, msg, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		if mt != websocket.BinaryMessage {
+			log.Println("忽略非二进制消息:", mt)
+			continue
+		}
+		if c.callback != nil {
+			c.callback(c, msg)
+		}
+	}
+}
+
+// connected 切换到新连接，之后入队的消息写到该连接上
+func (c *WSClient) connected() {
+	c.sendMu.Lock()
+	c.drain()
+	c.down = make(chan struct{})
+	c.state.Store(int32(StateConnected))
+	c.sendMu.Unlock()
+	c.setState(StateConnected, nil)
+}
+
+// disconnected 连接断开后拒绝新的发送，并丢弃尚未写出的消息
+func (c *WSClient) disconnected() {
+	close(c.down)
+	c.sendMu.Lock()
+	c.state.Store(int32(StateDisconnected))
+	c.drain()
+	c.sendMu.Unlock()
+}
+
+// drain 丢弃断线时尚未写出的消息
+func (c *WSClient) drain() {
+	for {
+		select {
+		case <-c.send:
+		default:
+			return
+		}
+	}
+}
+
+// 主动发消息，data 须为完整的帧（含帧头），未连接、发送队列已满或客户端已关闭时丢弃
+func (c *WSClient) SendMessage(data []byte) {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.ctx.Err() != nil || c.State() != StateConnected {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+		log.Println("发送队列已满，消息丢弃")
+	}
+}
+
+// Send 与 SendMessage 相同，但发送队列已满时等待，直到入队、ctx 取消、连接断开或客户端关闭。
+// 未连接（含重连中）时返回 ErrNotConnected
+func (c *WSClient) Send(ctx context.Context, data []byte) error {
+	return c.sendFrame(ctx, data, nil)
+}
+
+// sendFrame 确认已连接后先调用 register 再入队，Client 用它登记等待回应的请求，
+// 使登记与入队不会跨越一次断线
+func (c *WSClient) sendFrame(ctx context.Context, data []byte, register func()) error {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.ctx.Err() != nil {
+		return ErrClosed
+	}
+	if c.State() != StateConnected {
+		return ErrNotConnected
+	}
+	if register != nil {
+		register()
+	}
+	select {
+	case c.send <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.down:
+		return ErrNotConnected
+	case <-c.ctx.Done():
+		return ErrClosed
+	}
+}
+
+// Close 关闭连接并停止重连，不等待监控协程退出（可在回调中调用），需要等待时使用 Done()。
+// 可重复调用，可与其他方法并发调用
+func (c *WSClient) Close() {
+	c.cancel()
+	c.lifeMu.Lock()
+	defer c.lifeMu.Unlock()
+	if !c.started {
+		// 未启动时直接结束，之后的 Start 返回 ErrClosed
+		c.started = true
+		close(c.stopped)
+	}
+}
+
+// ---------------- wsnet.IConnector ----------------
+
+func (c *WSClient) Put(key string, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.props[key] = v
+}
+
+func (c *WSClient) Get(key string) (any, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.props[key]
+	return v, ok
+}
+
+func (c *WSClient) SendData(data []byte) {
+	c.SendMessage(data)
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"goserver/msgdef"
+	"goserver/wsnet"
+)
+
+type stateEvent struct {
+	state State
+	err   error
+}
+
+// recordStates 返回接收状态变化的通道
+func recordStates() (chan stateEvent, StateCallback) {
+	ch := make(chan stateEvent, 64)
+	return ch, func(state State, err error) {
+		ch <- stateEvent{state, err}
+	}
+}
+
+// waitState 跳过其他状态，等待 want 并返回其错误
+func waitState(t *testing.T, ch <-chan stateEvent, want State) error {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			if ev.state == want {
+				return ev.err
+			}
+		case <-timeout:
+			t.Fatalf("state %v not reached", want)
+			return nil
+		}
+	}
+}
+
+func waitDone(t *testing.T, done <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("client not stopped")
+	}
+}
+
+func testFrame(t *testing.T, text string) []byte {
+	t.Helper()
+	frame, err := wsnet.EncodeFrame(wsnet.MessageID{MsgType: uint32(wsnet.MT_Notify), TypeID: 1, MsgID: 1}, []byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestReconnect(t *testing.T) {
+	srv := newTestServer(t)
+	states, cb := recordStates()
+	c := NewWSClient(srv.addr(), ReconnectOptions{BackoffMin: 10 * time.Millisecond})
+	c.SetStateCallback(cb)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Close()
+		waitDone(t, c.Done())
+	}()
+	waitState(t, states, StateConnected)
+	srv.accept(t).Close()
+
+	if err := waitState(t, states, StateDisconnected); err == nil {
+		t.Fatal("disconnect reason missing")
+	}
+	waitState(t, states, StateConnected)
+	conn := srv.accept(t)
+	if err := c.Send(context.Background(), testFrame(t, "after")); err != nil {
+		t.Fatal(err)
+	}
+	if _, payload := readFrame(t, conn); string(payload) != "after" {
+		t.Fatalf("payload = %q", payload)
+	}
+}
+
+// TestSendWhileReconnecting 重连期间的发送被拒绝，不会在新连接上写出没有等待者的请求
+func TestSendWhileReconnecting(t *testing.T) {
+	srv := newTestServer(t)
+	states, cb := recordStates()
+	c := New(srv.addr(), Options{Timeout: 2 * time.Second, Reconnect: ReconnectOptions{BackoffMin: 200 * time.Millisecond}})
+	c.OnState(cb)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Close()
+		waitDone(t, c.Done())
+	}()
+	waitState(t, states, StateConnected)
+	srv.accept(t).Close()
+	waitState(t, states, StateDisconnected)
+
+	ctx := context.Background()
+	if err := c.Call(ctx, msgdef.TypeSys, msgdef.MsgEcho, &msgdef.EchoReq{Text: "stale"}, nil); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Call err = %v, want ErrNotConnected", err)
+	}
+	if err := c.Notify(ctx, msgdef.TypeSys, msgdef.MsgHeartbeat, &msgdef.HeartbeatNotify{}); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("Notify err = %v, want ErrNotConnected", err)
+	}
+	c.Conn().SendMessage(testFrame(t, "dropped"))
+	if n := c.pendingLen(); n != 0 {
+		t.Fatalf("pending = %d, want 0", n)
+	}
+
+	waitState(t, states, StateConnected)
+	conn := srv.accept(t)
+	done := goEcho(c, msgdef.MsgEcho, "fresh")
+	if _, payload := readFrame(t, conn); string(payload) != `{"text":"fresh"}` {
+		t.Fatalf("first frame on new connection = %s", payload)
+	}
+	writeFrame(t, conn, wsnet.MT_Response, msgdef.TypeSys, msgdef.MsgEcho, msgdef.EchoResp{Text: "ok"})
+	if res := wait(t, done); res.err != nil || res.resp.Text != "ok" {
+		t.Fatalf("call = %+v, %v", res.resp, res.err)
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	srv := newTestServer(t)
+	states, cb := recordStates()
+	c := NewWSClient(srv.addr(), ReconnectOptions{BackoffMin: 5 * time.Millisecond, MaxAttempts: 2})
+	c.SetStateCallback(cb)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn := srv.accept(t)
+	srv.Close()
+	conn.Close()
+
+	waitDone(t, c.Done())
+	var last stateEvent
+	for len(states) > 0 {
+		last = <-states
+	}
+	if last.state != StateDisconnected || !errors.Is(last.err, ErrReconnectFailed) {
+		t.Fatalf("last state = %v %v, want disconnected with ErrReconnectFailed", last.state, last.err)
+	}
+	if err := c.Send(context.Background(), testFrame(t, "x")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Send err = %v, want ErrClosed", err)
+	}
+	if err := c.Start(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Start err = %v, want ErrClosed", err)
+	}
+}
+
+// TestCloseRepeated Close 可重复、并发调用，服务端收到正常关闭
+func TestCloseRepeated(t *testing.T) {
+	srv := newTestServer(t)
+	c := NewWSClient(srv.addr(), ReconnectOptions{})
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	conn := srv.accept(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+	wg.Wait()
+	waitDone(t, c.Done())
+	c.Close()
+	if c.State() != StateDisconnected {
+		t.Fatalf("state = %v, want disconnected", c.State())
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("server read err = %v, want normal closure", err)
+	}
+	if err := c.Start(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Start err = %v, want ErrClosed", err)
+	}
+}
+
+// TestCloseWhileReconnecting 退避等待期间 Close 立即停止
+func TestCloseWhileReconnecting(t *testing.T) {
+	srv := newTestServer(t)
+	states, cb := recordStates()
+	c := NewWSClient(srv.addr(), ReconnectOptions{BackoffMin: time.Hour})
+	c.SetStateCallback(cb)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	srv.accept(t).Close()
+	waitState(t, states, StateDisconnected)
+
+	c.Close()
+	waitDone(t, c.Done())
+}
+
+func TestCloseBeforeStart(t *testing.T) {
+	c := NewWSClient("127.0.0.1:1", ReconnectOptions{})
+	c.Close()
+	waitDone(t, c.Done())
+	c.Close()
+	if err := c.Start(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Start err = %v, want ErrClosed", err)
+	}
+}
+
+func TestStart(t *testing.T) {
+	srv := newTestServer(t)
+	c := NewWSClient(srv.addr(), ReconnectOptions{})
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	srv.accept(t)
+	if err := c.Start(); !errors.Is(err, ErrStarted) {
+		t.Fatalf("Start err = %v, want ErrStarted", err)
+	}
+	c.Close()
+	waitDone(t, c.Done())
+
+	// 初次连接失败后客户端停止且不可再用
+	srv.Close()
+	c = NewWSClient(srv.addr(), ReconnectOptions{})
+	if err := c.Start(); err == nil {
+		t.Fatal("Start should fail without a server")
+	}
+	waitDone(t, c.Done())
+	if err := c.Start(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Start err = %v, want ErrClosed", err)
+	}
+}
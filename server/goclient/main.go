@@ -1,18 +1,58 @@
 package main
 
 import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
 	"time"
+
+	"goclient/client"
+	"goserver/msgdef"
 )
 
 func main() {
-	client := NewWSClient("localhost:8080") // 修改为你的服务端地址
-	go client.Start()
+	c := client.New("localhost:8080", client.Options{}) // 修改为你的服务端地址
+	c.OnPush(msgdef.TypeSys, func(msgID uint32, payload []byte) {
+		if msgID != msgdef.MsgKick {
+			return
+		}
+		var msg msgdef.KickPush
+		if err := c.Decode(msgdef.TypeSys, payload, &msg); err == nil {
+			log.Printf("被踢下线: %d %s", msg.Code, msg.Reason)
+		}
+	})
+	c.OnState(func(state client.State, err error) {
+		log.Println("连接状态:", state, err)
+	})
+	if err := c.Start(); err != nil {
+		log.Fatal("初次连接失败:", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	// 模拟主动发消息
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 	for {
-		<-ticker.C
-		client.SendMessage([]byte("Hello Server!"))
+		select {
+		case <-ctx.Done():
+			log.Println("收到退出信号")
+			c.Close()
+			<-c.Done()
+			return
+		case <-c.Done():
+			log.Println("客户端已停止")
+			return
+		case <-ticker.C:
+		}
+		resp, err := client.Request[msgdef.EchoResp](ctx, c, msgdef.TypeSys, msgdef.MsgEcho, &msgdef.EchoReq{Text: "Hello Server!"})
+		if err != nil {
+			log.Println("请求失败:", err)
+			continue
+		}
+		log.Println("收到回应:", resp.Text)
+		_ = c.Notify(ctx, msgdef.TypeSys, msgdef.MsgHeartbeat, &msgdef.HeartbeatNotify{Time: time.Now().Unix()})
 	}
 }
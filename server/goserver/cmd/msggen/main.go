@@ -0,0 +1,336 @@
+// msggen 根据消息定义文件（messages.json）生成 Go 与 TypeScript 代码，
+// 保证服务端 wsnet 与客户端 NetWork 模块使用同一套消息编号。
+// int64 字段在 JSON 中以字符串传输（TypeScript 端为 string），避免超过 2^53 后丢失精度。
+//
+//	go run ./cmd/msggen -schema msgdef/messages.json -go msgdef/messages_gen.go -ts path/to/MsgDefine.ts
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type Message struct {
+	Name     string  `json:"name"`
+	ID       uint32  `json:"id"`
+	Kind     string  `json:"kind"` // request | notify | push
+	Fields   []Field `json:"fields"`
+	Response []Field `json:"response"` // 仅 request 使用
+}
+
+type MsgType struct {
+	Name     string    `json:"name"`
+	ID       uint32    `json:"id"`
+	Messages []Message `json:"messages"`
+}
+
+type Schema struct {
+	Types []MsgType `json:"types"`
+}
+
+var (
+	identRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+	goTypes = map[string]string{
+		"string":  "string",
+		"bool":    "bool",
+		"int32":   "int32",
+		"int64":   "int64",
+		"uint32":  "uint32",
+		"float32": "float32",
+		"float64": "float64",
+	}
+	tsTypes = map[string]string{
+		"string":  "string",
+		"bool":    "boolean",
+		"int32":   "number",
+		"int64":   "string", // 超过 2^53 的整数在 number 中会丢失精度，JSON 中以字符串传输
+		"uint32":  "number",
+		"float32": "number",
+		"float64": "number",
+	}
+)
+
+func main() {
+	schemaPath := flag.String("schema", "messages.json", "消息定义文件")
+	goOut := flag.String("go", "", "Go 输出文件")
+	goPkg := flag.String("pkg", "msgdef", "Go 包名")
+	tsOut := flag.String("ts", "", "TypeScript 输出文件")
+	flag.Parse()
+
+	data, err := os.ReadFile(*schemaPath)
+	if err != nil {
+		log.Fatalf("read schema err: %v", err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		log.Fatalf("parse schema err: %v", err)
+	}
+	if err := validate(&schema); err != nil {
+		log.Fatalf("invalid schema: %v", err)
+	}
+
+	if *goOut != "" {
+		if err := render(*goOut, goTmpl, map[string]any{"Pkg": *goPkg, "Schema": schema}, true); err != nil {
+			log.Fatalf("generate go err: %v", err)
+		}
+	}
+	if *tsOut != "" {
+		if err := render(*tsOut, tsTmpl, map[string]any{"Schema": schema}, false); err != nil {
+			log.Fatalf("generate ts err: %v", err)
+		}
+	}
+}
+
+func validate(s *Schema) error {
+	typeIDs := make(map[uint32]string)
+	names := make(map[string]string)
+	for _, t := range s.Types {
+		if !identRe.MatchString(t.Name) {
+			return fmt.Errorf("bad type name %q", t.Name)
+		}
+		if t.ID > 0x3FF {
+			return fmt.Errorf("type %s: id %d out of range (0 ~ 1023)", t.Name, t.ID)
+		}
+		if other, ok := typeIDs[t.ID]; ok {
+			return fmt.Errorf("type %s: id %d already used by %s", t.Name, t.ID, other)
+		}
+		typeIDs[t.ID] = t.Name
+
+		msgIDs := make(map[uint32]string)
+		for _, m := range t.Messages {
+			if !identRe.MatchString(m.Name) {
+				return fmt.Errorf("type %s: bad message name %q", t.Name, m.Name)
+			}
+			if other, ok := names[m.Name]; ok {
+				return fmt.Errorf("message %s: name already used in type %s", m.Name, other)
+			}
+			names[m.Name] = t.Name
+			if m.ID > 0x1FFF {
+				return fmt.Errorf("message %s: id %d out of range (0 ~ 8191)", m.Name, m.ID)
+			}
+			if other, ok := msgIDs[m.ID]; ok {
+				return fmt.Errorf("message %s: id %d already used by %s", m.Name, m.ID, other)
+			}
+			msgIDs[m.ID] = m.Name
+
+			switch m.Kind {
+			case "request":
+			case "notify", "push":
+				if len(m.Response) > 0 {
+					return fmt.Errorf("message %s: only request can declare response", m.Name)
+				}
+			default:
+				return fmt.Errorf("message %s: unknown kind %q", m.Name, m.Kind)
+			}
+			for _, f := range append(m.Fields, m.Response...) {
+				if !identRe.MatchString(f.Name) {
+					return fmt.Errorf("message %s: bad field name %q", m.Name, f.Name)
+				}
+				if _, ok := goTypes[strings.TrimPrefix(f.Type, "[]")]; !ok {
+					return fmt.Errorf("message %s: field %s has unknown type %q", m.Name, f.Name, f.Type)
+				}
+				// encoding/json 的 ,string 选项对切片无效，无法保证 TypeScript 端的精度
+				if f.Type == "[]int64" {
+					return fmt.Errorf("message %s: field %s: []int64 is not supported, use []string", m.Name, f.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func render(path, text string, data any, gofmt bool) error {
+	out, err := generate(text, data, gofmt)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+func generate(text string, data any, gofmt bool) ([]byte, error) {
+	tmpl, err := template.New("msggen").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !gofmt {
+		return buf.Bytes(), nil
+	}
+	return format.Source(buf.Bytes())
+}
+
+var funcs = template.FuncMap{
+	"export": func(s string) string {
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"goType": func(t string) string {
+		if elem, ok := strings.CutPrefix(t, "[]"); ok {
+			return "[]" + goTypes[elem]
+		}
+		return goTypes[t]
+	},
+	// int64 在 JSON 中以字符串传输，与 TypeScript 端的 string 类型对应
+	"tag": func(f Field) string {
+		name := f.Name
+		if f.Type == "int64" {
+			name += ",string"
+		}
+		return fmt.Sprintf("`json:%q msgpack:%q`", name, f.Name)
+	},
+	"tsType": func(t string) string {
+		if elem, ok := strings.CutPrefix(t, "[]"); ok {
+			return tsTypes[elem] + "[]"
+		}
+		return tsTypes[t]
+	},
+	// 消息体结构名：request -> XxxReq/XxxResp，notify -> XxxNotify，push -> XxxPush
+	"body": func(m Message) string {
+		switch m.Kind {
+		case "request":
+			return m.Name + "Req"
+		case "notify":
+			return m.Name + "Notify"
+		default:
+			return m.Name + "Push"
+		}
+	},
+	"msgType": func(m Message) string {
+		return map[string]string{"request": "Request", "notify": "Notify", "push": "Push"}[m.Kind]
+	},
+}
+
+const goTmpl = `// Code generated by msggen from messages.json. DO NOT EDIT.
+
+package {{.Pkg}}
+
+import "goserver/wsnet"
+
+// 类型ID
+const (
+{{- range .Schema.Types}}
+	Type{{.Name}} uint32 = {{.ID}}
+{{- end}}
+)
+
+// 消息编号
+const (
+{{- range .Schema.Types}}{{range .Messages}}
+	Msg{{.Name}} uint32 = {{.ID}}
+{{- end}}{{end}}
+)
+{{range .Schema.Types}}{{range $m := .Messages}}
+type {{body $m}} struct {
+{{- range .Fields}}
+	{{export .Name}} {{goType .Type}} {{tag .}}
+{{- end}}
+}
+{{if eq .Kind "request"}}
+type {{.Name}}Resp struct {
+{{- range .Response}}
+	{{export .Name}} {{goType .Type}} {{tag .}}
+{{- end}}
+}
+{{end}}{{end}}{{end}}
+// Handlers 客户端消息（request/notify）的处理接口
+type Handlers interface {
+{{- range .Schema.Types}}{{range .Messages}}
+{{- if eq .Kind "request"}}
+	{{.Name}}(conn wsnet.IConnector, req *{{.Name}}Req) (*{{.Name}}Resp, error)
+{{- else if eq .Kind "notify"}}
+	{{.Name}}(conn wsnet.IConnector, msg *{{.Name}}Notify) error
+{{- end}}
+{{- end}}{{end}}
+}
+
+// Register 将 Handlers 注册到路由
+func Register(r *wsnet.Router, h Handlers) {
+{{- range $t := .Schema.Types}}{{range .Messages}}
+{{- if eq .Kind "request"}}
+	wsnet.Handle(r, Type{{$t.Name}}, Msg{{.Name}}, h.{{.Name}})
+{{- else if eq .Kind "notify"}}
+	wsnet.Handle(r, Type{{$t.Name}}, Msg{{.Name}}, func(conn wsnet.IConnector, msg *{{.Name}}Notify) (struct{}, error) {
+		return struct{}{}, h.{{.Name}}(conn, msg)
+	})
+{{- end}}
+{{- end}}{{end}}
+}
+{{range $t := .Schema.Types}}{{range .Messages}}{{if eq .Kind "push"}}
+// Push{{.Name}} 推送 {{.Name}}Push
+func Push{{.Name}}(r *wsnet.Router, conn wsnet.IConnector, msg *{{.Name}}Push) error {
+	return r.Push(conn, Type{{$t.Name}}, Msg{{.Name}}, msg)
+}
+{{end}}{{end}}{{end}}`
+
+const tsTmpl = `// 本文件由 msggen 根据 messages.json 生成，请勿手动修改
+
+import { Message, MsgType, WsCoder } from './WsCoder';
+
+/** 类型ID */
+export const TypeID = {
+{{- range .Schema.Types}}
+    {{.Name}}: {{.ID}},
+{{- end}}
+} as const;
+
+/** 消息编号 */
+export const MsgID = {
+{{- range .Schema.Types}}{{range .Messages}}
+    {{.Name}}: {{.ID}},
+{{- end}}{{end}}
+} as const;
+{{range .Schema.Types}}{{range $m := .Messages}}
+export interface {{body $m}} {
+{{- range .Fields}}
+    {{.Name}}: {{tsType .Type}};
+{{- end}}
+}
+{{if eq .Kind "request"}}
+export interface {{.Name}}Resp {
+{{- range .Response}}
+    {{.Name}}: {{tsType .Type}};
+{{- end}}
+}
+{{end}}{{end}}{{end}}
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+function encodeJson(msgType: MsgType, typeID: number, msgID: number, body: object): Message {
+    return new Message(WsCoder.encodeHeader(msgType, typeID, msgID), textEncoder.encode(JSON.stringify(body)));
+}
+
+function decodeJson<T>(data: Uint8Array): T {
+    return JSON.parse(textDecoder.decode(data)) as T;
+}
+{{range $t := .Schema.Types}}{{range $m := .Messages}}{{if eq .Kind "push"}}
+/** 解码 {{.Name}}Push */
+export function decode{{.Name}}Push(data: Uint8Array): {{.Name}}Push {
+    return decodeJson<{{.Name}}Push>(data);
+}
+{{else}}
+/** 编码 {{body $m}}，返回的消息可直接交给 Ws.sendBuffer(msg.cmd, msg.data) */
+export function encode{{body $m}}(msg: {{body $m}}): Message {
+    return encodeJson(MsgType.{{msgType $m}}, TypeID.{{$t.Name}}, MsgID.{{.Name}}, msg);
+}
+{{if eq .Kind "request"}}
+/** 解码 {{.Name}}Resp */
+export function decode{{.Name}}Resp(data: Uint8Array): {{.Name}}Resp {
+    return decodeJson<{{.Name}}Resp>(data);
+}
+{{end}}{{end}}{{end}}{{end}}`
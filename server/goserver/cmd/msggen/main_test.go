@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+func loadSchema(t *testing.T) Schema {
+	t.Helper()
+	data, err := os.ReadFile("testdata/messages.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := validate(&schema); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// TestGolden 生成结果与 testdata 中的 golden 文件一致，修改模板后用 go test -update 更新
+func TestGolden(t *testing.T) {
+	schema := loadSchema(t)
+	tests := []struct {
+		golden string
+		text   string
+		data   any
+		gofmt  bool
+	}{
+		{"messages_gen.go.golden", goTmpl, map[string]any{"Pkg": "msgdef", "Schema": schema}, true},
+		{"MsgDefine.ts.golden", tsTmpl, map[string]any{"Schema": schema}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			got, err := generate(tt.text, tt.data, tt.gofmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s is out of date, run go test ./cmd/msggen -update\n--- got\n%s", tt.golden, got)
+			}
+		})
+	}
+}
+
+// TestInt64AsString int64 在 JSON 中以字符串传输，TypeScript 端为 string，避免超过 2^53 后丢失精度
+func TestInt64AsString(t *testing.T) {
+	schema := loadSchema(t)
+	goSrc, err := generate(goTmpl, map[string]any{"Pkg": "msgdef", "Schema": schema}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(goSrc, []byte("Uid   int64    `json:\"uid,string\" msgpack:\"uid\"`")) {
+		t.Errorf("int64 field should use the ,string json option:\n%s", goSrc)
+	}
+	tsSrc, err := generate(tsTmpl, map[string]any{"Schema": schema}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(tsSrc, []byte("uid: string;")) {
+		t.Errorf("int64 field should be a string in TypeScript:\n%s", tsSrc)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	msg := func(kind string, fields ...Field) MsgType {
+		return MsgType{Name: "Sys", ID: 1, Messages: []Message{{Name: "Login", ID: 1, Kind: kind, Fields: fields}}}
+	}
+	tests := []struct {
+		name   string
+		schema Schema
+		want   string
+	}{
+		{"TypeIDRange", Schema{Types: []MsgType{{Name: "Sys", ID: 1024}}}, "out of range"},
+		{"DuplicateTypeID", Schema{Types: []MsgType{{Name: "A", ID: 1}, {Name: "B", ID: 1}}}, "already used"},
+		{"BadTypeName", Schema{Types: []MsgType{{Name: "1Sys", ID: 1}}}, "bad type name"},
+		{"UnknownKind", Schema{Types: []MsgType{msg("event")}}, "unknown kind"},
+		{"UnknownFieldType", Schema{Types: []MsgType{msg("notify", Field{"a", "uint64"})}}, "unknown type"},
+		{"Int64Slice", Schema{Types: []MsgType{msg("notify", Field{"ids", "[]int64"})}}, "[]int64 is not supported"},
+		{"Valid", Schema{Types: []MsgType{msg("request", Field{"uid", "int64"})}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate(&tt.schema)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+// Package dbtest 基于 miniredis 的内存 Redis，用于离线测试依赖 db 包的代码
+package dbtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"goserver/db"
+)
+
+/*
+NewStore 启动一个内存 Redis 并返回连接它的实例，测试结束时自动关闭。
+返回的 miniredis 可用于直接检查数据或调用 FastForward 模拟时间流逝（TTL 不会随真实时间减少）
+
+	func TestBuy(t *testing.T) {
+		store, mr := dbtest.NewStore(t)
+		...
+		if !mr.Exists("order:1") { t.Fatal("order not saved") }
+	}
+*/
+func NewStore(t testing.TB) (*db.RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store, err := db.NewRedisStore(context.Background(), db.Config{Client: client, AllowFlush: true})
+	if err != nil {
+		t.Fatalf("dbtest: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store, mr
+}
+
+// InitDefault 与 NewStore 相同，并将其设为 db 包的默认实例，测试结束后恢复。
+// 使用包级函数（db.Set、db.TryLock 等）的测试不能并行执行
+func InitDefault(t testing.TB) (*db.RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	store, mr := NewStore(t)
+	prev := db.Default()
+	db.SetDefault(store)
+	t.Cleanup(func() { db.SetDefault(prev) })
+	return store, mr
+}
@@ -0,0 +1,668 @@
+package dbtest
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"goserver/db"
+)
+
+var _ db.MongoCollection = (*Collection)(nil)
+
+/*
+Collection 内存中的 Mongo 集合，实现 db.MongoCollection，用于离线测试 FindOne、FindPage、Repository 等。
+只支持测试用到的子集：过滤条件为字段相等（支持 a.b 路径）与 $eq $ne $gt $gte $lt $lte $in，
+更新为 $set $inc $unset，Find 选项为 Sort、Skip、Limit。_id 唯一，重复时返回与服务端相同错误码（11000）的错误
+
+	coll := dbtest.NewCollection()
+	_ = db.Upsert(ctx, coll, bson.M{"_id": "p1"}, player)
+	coll.SetError(errors.New("mongo down")) // 模拟故障
+*/
+type Collection struct {
+	mu   sync.Mutex
+	docs []bson.D // 按插入顺序
+	err  error
+}
+
+// NewCollection 创建空集合
+func NewCollection() *Collection {
+	return &Collection{}
+}
+
+// SetError 之后的所有操作都返回 err，传 nil 恢复
+func (c *Collection) SetError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// Docs 当前所有文档的副本，按插入顺序
+func (c *Collection) Docs() []bson.D {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.docs)
+}
+
+// Len 文档数
+func (c *Collection) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.docs)
+}
+
+func (c *Collection) FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult {
+	var o options.FindOneOptions
+	if err := apply(&o, opts); err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	one := int64(1)
+	docs, err := c.find(filter, o.Sort, o.Skip, &one)
+	if err == nil && len(docs) == 0 {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	return mongo.NewSingleResultFromDocument(docs[0], nil, nil)
+}
+
+func (c *Collection) Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error) {
+	var o options.FindOptions
+	if err := apply(&o, opts); err != nil {
+		return nil, err
+	}
+	docs, err := c.find(filter, o.Sort, o.Skip, o.Limit)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]any, len(docs))
+	for i, d := range docs {
+		items[i] = d
+	}
+	return mongo.NewCursorFromDocuments(items, nil, nil)
+}
+
+func (c *Collection) CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error) {
+	docs, err := c.find(filter, nil, nil, nil)
+	return int64(len(docs)), err
+}
+
+func (c *Collection) InsertOne(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	id, err := c.insert(document, nil)
+	if err != nil {
+		return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{*err}}
+	}
+	return &mongo.InsertOneResult{InsertedID: id, Acknowledged: true}, nil
+}
+
+func (c *Collection) UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error) {
+	var o options.UpdateOneOptions
+	if err := apply(&o, opts); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	res, we, err := c.update(filter, update, o.Upsert != nil && *o.Upsert)
+	if we != nil {
+		return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{*we}}
+	}
+	return res, err
+}
+
+func (c *Collection) ReplaceOne(ctx context.Context, filter any, replacement any, opts ...options.Lister[options.ReplaceOptions]) (*mongo.UpdateResult, error) {
+	var o options.ReplaceOptions
+	if err := apply(&o, opts); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	res, we, err := c.replace(filter, replacement, o.Upsert != nil && *o.Upsert)
+	if we != nil {
+		return nil, mongo.WriteException{WriteErrors: []mongo.WriteError{*we}}
+	}
+	return res, err
+}
+
+func (c *Collection) DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	n, err := c.delete(filter)
+	return &mongo.DeleteResult{DeletedCount: n, Acknowledged: true}, err
+}
+
+// BulkWrite 支持 InsertOne、UpdateOne、ReplaceOne、DeleteOne 模型，Ordered 为 false 时出错后继续执行
+func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error) {
+	var o options.BulkWriteOptions
+	if err := apply(&o, opts); err != nil {
+		return nil, err
+	}
+	ordered := o.Ordered == nil || *o.Ordered
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	res := &mongo.BulkWriteResult{UpsertedIDs: make(map[int64]any), Acknowledged: true}
+	var errs []mongo.BulkWriteError
+	for i, model := range models {
+		var (
+			ur  *mongo.UpdateResult
+			we  *mongo.WriteError
+			err error
+		)
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			if _, we = c.insert(m.Document, nil); we == nil {
+				res.InsertedCount++
+			}
+		case *mongo.UpdateOneModel:
+			ur, we, err = c.update(m.Filter, m.Update, m.Upsert != nil && *m.Upsert)
+		case *mongo.ReplaceOneModel:
+			ur, we, err = c.replace(m.Filter, m.Replacement, m.Upsert != nil && *m.Upsert)
+		case *mongo.DeleteOneModel:
+			var n int64
+			n, err = c.delete(m.Filter)
+			res.DeletedCount += n
+		default:
+			err = fmt.Errorf("dbtest: unsupported write model %T", model)
+		}
+		if err != nil {
+			return res, err
+		}
+		if ur != nil {
+			res.MatchedCount += ur.MatchedCount
+			res.ModifiedCount += ur.ModifiedCount
+			res.UpsertedCount += ur.UpsertedCount
+			if ur.UpsertedID != nil {
+				res.UpsertedIDs[int64(i)] = ur.UpsertedID
+			}
+		}
+		if we != nil {
+			we.Index = i
+			errs = append(errs, mongo.BulkWriteError{WriteError: *we, Request: model})
+			if ordered {
+				break
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return res, mongo.BulkWriteException{WriteErrors: errs}
+	}
+	return res, nil
+}
+
+// ---------------- 内部实现，除 find 外调用方须持有 c.mu ----------------
+
+func (c *Collection) find(filter, sort any, skip, limit *int64) ([]bson.D, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	f, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	var out []bson.D
+	for _, d := range c.docs {
+		ok, err := match(d, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, d)
+		}
+	}
+	if sort != nil {
+		keys, err := toDoc(sort)
+		if err != nil {
+			return nil, err
+		}
+		slices.SortStableFunc(out, func(a, b bson.D) int {
+			for _, k := range keys {
+				va, _ := lookup(a, k.Key)
+				vb, _ := lookup(b, k.Key)
+				n := compare(va, vb)
+				if dir, _ := number(k.Value); dir < 0 {
+					n = -n
+				}
+				if n != 0 {
+					return n
+				}
+			}
+			return 0
+		})
+	}
+	if skip != nil {
+		out = out[min(int(*skip), len(out)):]
+	}
+	if limit != nil && *limit > 0 {
+		out = out[:min(int(*limit), len(out))]
+	}
+	return out, nil
+}
+
+func (c *Collection) indexOf(filter bson.D) (int, error) {
+	for i, d := range c.docs {
+		ok, err := match(d, filter)
+		if err != nil {
+			return -1, err
+		}
+		if ok {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// insert 插入文档，缺少 _id 时生成 ObjectID，base 为 upsert 时从过滤条件继承的字段
+func (c *Collection) insert(document any, base bson.D) (any, *mongo.WriteError) {
+	d, err := toDoc(document)
+	if err != nil {
+		return nil, &mongo.WriteError{Code: 2, Message: err.Error()}
+	}
+	for _, e := range base {
+		if _, ok := lookup(d, e.Key); !ok {
+			d = append(d, e)
+		}
+	}
+	id, ok := lookup(d, "_id")
+	if !ok {
+		id = bson.NewObjectID()
+		d = append(bson.D{{Key: "_id", Value: id}}, d...)
+	}
+	for _, existing := range c.docs {
+		if v, _ := lookup(existing, "_id"); compare(v, id) == 0 {
+			return nil, duplicateKey(id)
+		}
+	}
+	c.docs = append(c.docs, d)
+	return id, nil
+}
+
+func (c *Collection) replace(filter, replacement any, upsert bool) (*mongo.UpdateResult, *mongo.WriteError, error) {
+	f, err := toDoc(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	doc, err := toDoc(replacement)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, err := c.indexOf(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i < 0 {
+		if !upsert {
+			return &mongo.UpdateResult{Acknowledged: true}, nil, nil
+		}
+		id, we := c.insert(doc, equalities(f))
+		if we != nil {
+			return nil, we, nil
+		}
+		return &mongo.UpdateResult{UpsertedCount: 1, UpsertedID: id, Acknowledged: true}, nil, nil
+	}
+	id, _ := lookup(c.docs[i], "_id")
+	if v, ok := lookup(doc, "_id"); ok && compare(v, id) != 0 {
+		return nil, &mongo.WriteError{Code: 66, Message: "the (immutable) field '_id' was found to have been altered"}, nil
+	}
+	out := bson.D{{Key: "_id", Value: id}}
+	for _, e := range doc {
+		if e.Key != "_id" {
+			out = append(out, e)
+		}
+	}
+	c.docs[i] = out
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1, Acknowledged: true}, nil, nil
+}
+
+func (c *Collection) update(filter, update any, upsert bool) (*mongo.UpdateResult, *mongo.WriteError, error) {
+	f, err := toDoc(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := toDoc(update)
+	if err != nil {
+		return nil, nil, err
+	}
+	i, err := c.indexOf(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if i < 0 {
+		if !upsert {
+			return &mongo.UpdateResult{Acknowledged: true}, nil, nil
+		}
+		d, err := applyUpdate(equalities(f), u)
+		if err != nil {
+			return nil, nil, err
+		}
+		id, we := c.insert(d, nil)
+		if we != nil {
+			return nil, we, nil
+		}
+		return &mongo.UpdateResult{UpsertedCount: 1, UpsertedID: id, Acknowledged: true}, nil, nil
+	}
+	d, err := applyUpdate(slices.Clone(c.docs[i]), u)
+	if err != nil {
+		return nil, nil, err
+	}
+	modified := int64(0)
+	if !reflect.DeepEqual(d, c.docs[i]) {
+		modified = 1
+	}
+	c.docs[i] = d
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: modified, Acknowledged: true}, nil, nil
+}
+
+func (c *Collection) delete(filter any) (int64, error) {
+	f, err := toDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+	i, err := c.indexOf(f)
+	if err != nil || i < 0 {
+		return 0, err
+	}
+	c.docs = slices.Delete(c.docs, i, i+1)
+	return 1, nil
+}
+
+func duplicateKey(id any) *mongo.WriteError {
+	return &mongo.WriteError{Code: 11000, Message: fmt.Sprintf("E11000 duplicate key error dup key: { _id: %v }", id)}
+}
+
+// ---------------- 文档与查询 ----------------
+
+// toDoc 经 BSON 编解码把任意文档（结构体、bson.M、bson.D）转为 bson.D，与驱动的序列化结果一致
+func toDoc(v any) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	err = bson.Unmarshal(raw, &d)
+	return d, err
+}
+
+func apply[T any](o *T, opts []options.Lister[T]) error {
+	for _, l := range opts {
+		if l == nil {
+			continue
+		}
+		for _, fn := range l.List() {
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup 按 a.b 路径读取字段
+func lookup(d bson.D, path string) (any, bool) {
+	head, rest, nested := strings.Cut(path, ".")
+	for _, e := range d {
+		if e.Key != head {
+			continue
+		}
+		if !nested {
+			return e.Value, true
+		}
+		sub, ok := e.Value.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		return lookup(sub, rest)
+	}
+	return nil, false
+}
+
+// set 按 a.b 路径写入字段，中间文档不存在时创建
+func set(d bson.D, path string, v any) bson.D {
+	head, rest, nested := strings.Cut(path, ".")
+	for i, e := range d {
+		if e.Key != head {
+			continue
+		}
+		if !nested {
+			d[i].Value = v
+			return d
+		}
+		sub, _ := e.Value.(bson.D)
+		d[i].Value = set(slices.Clone(sub), rest, v)
+		return d
+	}
+	if nested {
+		return append(d, bson.E{Key: head, Value: set(nil, rest, v)})
+	}
+	return append(d, bson.E{Key: head, Value: v})
+}
+
+func unset(d bson.D, path string) bson.D {
+	head, rest, nested := strings.Cut(path, ".")
+	for i, e := range d {
+		if e.Key != head {
+			continue
+		}
+		if !nested {
+			return slices.Delete(d, i, i+1)
+		}
+		if sub, ok := e.Value.(bson.D); ok {
+			d[i].Value = unset(slices.Clone(sub), rest)
+		}
+		return d
+	}
+	return d
+}
+
+// equalities 过滤条件中的相等字段，upsert 插入时写入新文档
+func equalities(filter bson.D) bson.D {
+	var out bson.D
+	for _, e := range filter {
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		if ops, ok := e.Value.(bson.D); ok && len(ops) > 0 && strings.HasPrefix(ops[0].Key, "$") {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func match(d, filter bson.D) (bool, error) {
+	for _, cond := range filter {
+		if strings.HasPrefix(cond.Key, "$") {
+			return false, fmt.Errorf("dbtest: unsupported query operator %s", cond.Key)
+		}
+		v, exists := lookup(d, cond.Key)
+		ops, isOps := cond.Value.(bson.D)
+		if !isOps || len(ops) == 0 || !strings.HasPrefix(ops[0].Key, "$") {
+			if !exists || compare(v, cond.Value) != 0 {
+				return false, nil
+			}
+			continue
+		}
+		for _, op := range ops {
+			ok, err := matchOp(v, exists, op)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func matchOp(v any, exists bool, op bson.E) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return exists && compare(v, op.Value) == 0, nil
+	case "$ne":
+		return !exists || compare(v, op.Value) != 0, nil
+	case "$in":
+		list, ok := op.Value.(bson.A)
+		if !ok {
+			return false, errors.New("dbtest: $in needs an array")
+		}
+		return exists && slices.ContainsFunc(list, func(x any) bool { return compare(v, x) == 0 }), nil
+	}
+	if !exists || !ordered(v, op.Value) {
+		return false, nil
+	}
+	n := compare(v, op.Value)
+	switch op.Key {
+	case "$gt":
+		return n > 0, nil
+	case "$gte":
+		return n >= 0, nil
+	case "$lt":
+		return n < 0, nil
+	case "$lte":
+		return n <= 0, nil
+	}
+	return false, fmt.Errorf("dbtest: unsupported query operator %s", op.Key)
+}
+
+func applyUpdate(d, update bson.D) (bson.D, error) {
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("dbtest: update operator %s needs a document", op.Key)
+		}
+		for _, f := range fields {
+			if f.Key == "_id" {
+				return nil, errors.New("dbtest: _id is immutable")
+			}
+			switch op.Key {
+			case "$set":
+				d = set(d, f.Key, f.Value)
+			case "$unset":
+				d = unset(d, f.Key)
+			case "$inc":
+				cur, _ := lookup(d, f.Key)
+				d = set(d, f.Key, add(cur, f.Value))
+			default:
+				return nil, fmt.Errorf("dbtest: unsupported update operator %s", op.Key)
+			}
+		}
+	}
+	return d, nil
+}
+
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func add(a, b any) any {
+	switch x := a.(type) {
+	case nil:
+		return b
+	case int32:
+		if y, ok := b.(int32); ok {
+			return x + y
+		}
+	case int64:
+		switch y := b.(type) {
+		case int32:
+			return x + int64(y)
+		case int64:
+			return x + y
+		}
+	}
+	fa, _ := number(a)
+	fb, _ := number(b)
+	return fa + fb
+}
+
+// ordered 数字与数字、字符串与字符串之间才能比较大小，与服务端的类型区分一致
+func ordered(a, b any) bool {
+	_, na := number(a)
+	_, nb := number(b)
+	if na || nb {
+		return na && nb
+	}
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+// compare 比较两个 BSON 值，不同类型按类型名排序，不存在的字段最小
+func compare(a, b any) int {
+	if fa, ok := number(a); ok {
+		if fb, ok := number(b); ok {
+			return cmp.Compare(fa, fb)
+		}
+	}
+	switch x := a.(type) {
+	case nil:
+		if b == nil {
+			return 0
+		}
+		return -1
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0
+			case !x:
+				return -1
+			}
+			return 1
+		}
+	case bson.ObjectID:
+		if y, ok := b.(bson.ObjectID); ok {
+			return strings.Compare(x.Hex(), y.Hex())
+		}
+	case bson.DateTime:
+		if y, ok := b.(bson.DateTime); ok {
+			return cmp.Compare(x, y)
+		}
+	}
+	if b == nil {
+		return 1
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return strings.Compare(fmt.Sprintf("%T%v", a, a), fmt.Sprintf("%T%v", b, b))
+}
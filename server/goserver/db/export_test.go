@@ -0,0 +1,60 @@
+package db
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// 供 db_test 包测试未导出的实现
+
+var IndexModels = indexModels
+
+// NewMongoStoreWithClient 使用已创建的客户端，不做 PING 与建索引
+func NewMongoStoreWithClient(client *mongo.Client, database string) *MongoStore {
+	return &MongoStore{client: client, db: client.Database(database)}
+}
+
+// Sanitize 返回命令在慢日志中的形式
+func Sanitize(maxArgLen int, args ...interface{}) string {
+	h := &redisHook{opts: HookOptions{MaxArgLen: maxArgLen}}
+	return h.sanitize(redis.NewCmd(context.Background(), args...))
+}
+
+// Sweep 立即清理心跳已过期的节点
+func (p *Presence) Sweep(ctx context.Context) error {
+	return p.sweep(ctx)
+}
+
+// AfterPipeline 下一次 Pipeline 执行后调用 fn，用于构造与其他操作的交错；fn 中的 Pipeline 不再触发
+func (s *RedisStore) AfterPipeline(fn func()) {
+	h := &afterPipelineHook{fn: fn}
+	h.armed.Store(true)
+	s.rdb.AddHook(h)
+}
+
+type afterPipelineHook struct {
+	fn    func()
+	armed atomic.Bool
+}
+
+func (h *afterPipelineHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *afterPipelineHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (h *afterPipelineHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		if h.armed.CompareAndSwap(true, false) {
+			h.fn()
+		}
+		return err
+	}
+}
+
+// NewRedisStoreWithClient 使用已创建的客户端，不做 PING
+func NewRedisStoreWithClient(rdb redis.UniversalClient) *RedisStore {
+	return &RedisStore{rdb: rdb}
+}
@@ -1 +1,352 @@
 package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// MongoConfig MongoDB 配置
+type MongoConfig struct {
+	URI        string // 例如 mongodb://127.0.0.1:27017，副本集需带 replicaSet 参数才能使用事务
+	Database   string
+	Username   string // 为空时使用 URI 中的认证信息
+	Password   string
+	AuthSource string // 认证库，默认 admin
+
+	PoolSize        uint64        // 最大连接数，默认 100
+	MinPoolSize     uint64        // 最小空闲连接数
+	MaxConnIdleTime time.Duration // 空闲连接回收时间
+	Timeout         time.Duration // 单次操作默认超时，ctx 带 deadline 时以 ctx 为准，默认 5s
+
+	Indexes []IndexSpec // 启动时创建的索引
+}
+
+// IndexSpec 索引声明，已存在的同名同定义索引会被忽略
+type IndexSpec struct {
+	Collection string
+	Keys       bson.D        // 例如 bson.D{{Key: "uid", Value: 1}}
+	Name       string        // 为空时由服务端按字段生成
+	Unique     bool          // 唯一索引
+	Sparse     bool          // 稀疏索引，不索引缺少该字段的文档
+	TTL        time.Duration // 大于 0 时为 TTL 索引，Keys 须为单个时间字段
+}
+
+// MongoCollection FindOne / Upsert 等辅助函数依赖的集合操作，*mongo.Collection 满足该接口。
+// 测试时可用内存实现替换，结果通过 mongo.NewSingleResultFromDocument / mongo.NewCursorFromDocuments 构造
+type MongoCollection interface {
+	FindOne(ctx context.Context, filter any, opts ...options.Lister[options.FindOneOptions]) *mongo.SingleResult
+	Find(ctx context.Context, filter any, opts ...options.Lister[options.FindOptions]) (*mongo.Cursor, error)
+	CountDocuments(ctx context.Context, filter any, opts ...options.Lister[options.CountOptions]) (int64, error)
+	InsertOne(ctx context.Context, document any, opts ...options.Lister[options.InsertOneOptions]) (*mongo.InsertOneResult, error)
+	UpdateOne(ctx context.Context, filter any, update any, opts ...options.Lister[options.UpdateOneOptions]) (*mongo.UpdateResult, error)
+	ReplaceOne(ctx context.Context, filter any, replacement any, opts ...options.Lister[options.ReplaceOptions]) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter any, opts ...options.Lister[options.DeleteOneOptions]) (*mongo.DeleteResult, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...options.Lister[options.BulkWriteOptions]) (*mongo.BulkWriteResult, error)
+}
+
+// MongoStore MongoDB 客户端实例
+type MongoStore struct {
+	client *mongo.Client
+	db     *mongo.Database
+}
+
+// NewMongoStore 连接 MongoDB，PING 检查连通性后创建 cfg.Indexes 中声明的索引
+func NewMongoStore(ctx context.Context, cfg MongoConfig) (*MongoStore, error) {
+	if cfg.URI == "" || cfg.Database == "" {
+		return nil, errors.New("mongo: URI and Database are required")
+	}
+	if cfg.PoolSize == 0 {
+		cfg.PoolSize = 100
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	opts := options.Client().
+		ApplyURI(cfg.URI).
+		SetMaxPoolSize(cfg.PoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetConnectTimeout(5 * time.Second).
+		SetTimeout(cfg.Timeout)
+	if cfg.MaxConnIdleTime > 0 {
+		opts.SetMaxConnIdleTime(cfg.MaxConnIdleTime)
+	}
+	if cfg.Username != "" {
+		source := cfg.AuthSource
+		if source == "" {
+			source = "admin"
+		}
+		opts.SetAuth(options.Credential{Username: cfg.Username, Password: cfg.Password, AuthSource: source})
+	}
+
+	client, err := mongo.Connect(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, fmt.Errorf("mongo ping: %w", err)
+	}
+	s := &MongoStore{client: client, db: client.Database(cfg.Database)}
+	if err := s.EnsureIndexes(ctx, cfg.Indexes...); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
+	}
+	return s, nil
+}
+
+// Client 底层客户端，用于本文件未覆盖的操作
+func (s *MongoStore) Client() *mongo.Client {
+	return s.client
+}
+
+// Collection 获取集合
+func (s *MongoStore) Collection(name string) *mongo.Collection {
+	return s.db.Collection(name)
+}
+
+// Close 断开连接
+func (s *MongoStore) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+// EnsureIndexes 按集合批量创建索引
+func (s *MongoStore) EnsureIndexes(ctx context.Context, specs ...IndexSpec) error {
+	order, models, err := indexModels(specs)
+	if err != nil {
+		return err
+	}
+	for _, coll := range order {
+		if _, err := s.Collection(coll).Indexes().CreateMany(ctx, models[coll]); err != nil {
+			return fmt.Errorf("mongo create indexes on %s: %w", coll, err)
+		}
+	}
+	return nil
+}
+
+// indexModels 按集合分组索引声明，order 为集合首次出现的顺序
+func indexModels(specs []IndexSpec) (order []string, models map[string][]mongo.IndexModel, err error) {
+	models = make(map[string][]mongo.IndexModel)
+	for _, spec := range specs {
+		if spec.Collection == "" || len(spec.Keys) == 0 {
+			return nil, nil, errors.New("mongo index: Collection and Keys are required")
+		}
+		if spec.TTL > 0 && len(spec.Keys) != 1 {
+			return nil, nil, fmt.Errorf("mongo index on %s: TTL index must have a single key", spec.Collection)
+		}
+		opts := options.Index()
+		if spec.Name != "" {
+			opts.SetName(spec.Name)
+		}
+		if spec.Unique {
+			opts.SetUnique(true)
+		}
+		if spec.Sparse {
+			opts.SetSparse(true)
+		}
+		if spec.TTL > 0 {
+			opts.SetExpireAfterSeconds(int32(spec.TTL / time.Second))
+		}
+		if _, ok := models[spec.Collection]; !ok {
+			order = append(order, spec.Collection)
+		}
+		models[spec.Collection] = append(models[spec.Collection], mongo.IndexModel{Keys: spec.Keys, Options: opts})
+	}
+	return order, models, nil
+}
+
+/*
+WithTransaction 在事务中执行 fn，fn 内的操作必须使用传入的 ctx。
+遇到 TransientTransactionError 时驱动会自动重试 fn，fn 需可重复执行。需要副本集或分片集群
+
+	err := store.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := db.UpdateFields(ctx, players, bson.M{"_id": from}, bson.M{"gold": 0}); err != nil {
+			return err
+		}
+		return db.Upsert(ctx, mails, bson.M{"_id": mailID}, mail)
+	})
+*/
+func (s *MongoStore) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	sess, err := s.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer sess.EndSession(context.Background())
+	_, err = sess.WithTransaction(ctx, func(ctx context.Context) (any, error) {
+		return nil, fn(ctx)
+	})
+	return err
+}
+
+// ---------------- 类型化 CRUD ----------------
+
+// FindOne 查询一条文档并解码为 T，不存在时返回 ErrNotFound
+func FindOne[T any](ctx context.Context, coll MongoCollection, filter any, opts ...options.Lister[options.FindOneOptions]) (T, error) {
+	var v T
+	err := coll.FindOne(ctx, filter, opts...).Decode(&v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return v, ErrNotFound
+	}
+	return v, err
+}
+
+// FindAll 查询所有匹配的文档
+func FindAll[T any](ctx context.Context, coll MongoCollection, filter any, opts ...options.Lister[options.FindOptions]) ([]T, error) {
+	cur, err := coll.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]T, 0)
+	err = cur.All(ctx, &items)
+	return items, err
+}
+
+// Insert 插入一条文档，唯一索引冲突时可用 mongo.IsDuplicateKeyError 判断
+func Insert(ctx context.Context, coll MongoCollection, doc any) error {
+	_, err := coll.InsertOne(ctx, doc)
+	return err
+}
+
+// Upsert 按 filter 整体替换文档，不存在时插入
+func Upsert(ctx context.Context, coll MongoCollection, filter any, doc any) error {
+	_, err := coll.ReplaceOne(ctx, filter, doc, options.Replace().SetUpsert(true))
+	return err
+}
+
+// UpdateFields 按 filter 更新一条文档的部分字段（$set），没有匹配的文档时返回 ErrNotFound
+func UpdateFields(ctx context.Context, coll MongoCollection, filter any, fields bson.M) error {
+	res, err := coll.UpdateOne(ctx, filter, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteOne 删除一条文档，没有匹配的文档时返回 ErrNotFound
+func DeleteOne(ctx context.Context, coll MongoCollection, filter any) error {
+	res, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ---------------- 分页 ----------------
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// PageQuery 分页参数，Page 从 1 开始，Size 默认 20、最大 100
+type PageQuery struct {
+	Page int64
+	Size int64
+	Sort bson.D // 排序字段，为空时按 _id 升序，保证翻页稳定
+}
+
+// PageResult 分页结果
+type PageResult[T any] struct {
+	Items []T   `json:"items"`
+	Total int64 `json:"total"`
+	Page  int64 `json:"page"`
+	Size  int64 `json:"size"`
+}
+
+// Pages 总页数
+func (r PageResult[T]) Pages() int64 {
+	if r.Size <= 0 {
+		return 0
+	}
+	return (r.Total + r.Size - 1) / r.Size
+}
+
+// FindPage 分页查询，返回当前页数据与总数
+func FindPage[T any](ctx context.Context, coll MongoCollection, filter any, q PageQuery) (PageResult[T], error) {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.Size <= 0 {
+		q.Size = defaultPageSize
+	}
+	q.Size = min(q.Size, maxPageSize)
+	if len(q.Sort) == 0 {
+		q.Sort = bson.D{{Key: "_id", Value: 1}}
+	}
+
+	res := PageResult[T]{Page: q.Page, Size: q.Size}
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return res, err
+	}
+	res.Total = total
+	if (q.Page-1)*q.Size >= total {
+		res.Items = make([]T, 0)
+		return res, nil
+	}
+	opts := options.Find().SetSort(q.Sort).SetSkip((q.Page - 1) * q.Size).SetLimit(q.Size)
+	res.Items, err = FindAll[T](ctx, coll, filter, opts)
+	return res, err
+}
+
+// ---------------- 默认实例 ----------------
+
+var defaultMongo *MongoStore
+
+// InitMongo 初始化默认 MongoDB 实例
+func InitMongo(ctx context.Context, cfg MongoConfig) error {
+	s, err := NewMongoStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defaultMongo = s
+	return nil
+}
+
+// Mongo 默认 MongoDB 实例
+func Mongo() *MongoStore {
+	return defaultMongo
+}
+
+// C 默认实例上的集合
+func C(name string) *mongo.Collection {
+	return defaultMongo.Collection(name)
+}
+
+/*
+使用示例：
+
+	type Player struct {
+		ID    string `bson:"_id"`
+		Name  string `bson:"name"`
+		Level int    `bson:"level"`
+	}
+
+	err := db.InitMongo(ctx, db.MongoConfig{
+		URI:      "mongodb://127.0.0.1:27017",
+		Database: "game",
+		PoolSize: 50,
+		Indexes: []db.IndexSpec{
+			{Collection: "players", Keys: bson.D{{Key: "name", Value: 1}}, Unique: true},
+			{Collection: "logs", Keys: bson.D{{Key: "time", Value: 1}}, TTL: 7 * 24 * time.Hour},
+		},
+	})
+
+	players := db.C("players")
+	_ = db.Upsert(ctx, players, bson.M{"_id": "p1"}, Player{ID: "p1", Name: "tom", Level: 1})
+	p, err := db.FindOne[Player](ctx, players, bson.M{"_id": "p1"})
+	_ = db.UpdateFields(ctx, players, bson.M{"_id": "p1"}, bson.M{"level": 2})
+	page, err := db.FindPage[Player](ctx, players, bson.M{}, db.PageQuery{Page: 1, Size: 20, Sort: bson.D{{Key: "level", Value: -1}}})
+*/
@@ -0,0 +1,166 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+type player struct {
+	ID    string `bson:"_id"`
+	Name  string `bson:"name"`
+	Level int    `bson:"level"`
+}
+
+func TestMongoCRUD(t *testing.T) {
+	ctx := context.Background()
+	coll := dbtest.NewCollection()
+
+	must(t, db.Insert(ctx, coll, player{"p1", "tom", 1}))
+	if err := db.Insert(ctx, coll, player{"p1", "amy", 1}); !mongo.IsDuplicateKeyError(err) {
+		t.Fatalf("Insert err = %v, want duplicate key", err)
+	}
+
+	must(t, db.Upsert(ctx, coll, bson.M{"_id": "p2"}, player{"p2", "amy", 3}))
+	must(t, db.Upsert(ctx, coll, bson.M{"_id": "p2"}, player{"p2", "amy", 4}))
+	equal(t, coll.Len(), 2)
+
+	p, err := db.FindOne[player](ctx, coll, bson.M{"_id": "p2"})
+	must(t, err)
+	equal(t, p, player{"p2", "amy", 4})
+	if _, err := db.FindOne[player](ctx, coll, bson.M{"_id": "p3"}); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("FindOne err = %v, want ErrNotFound", err)
+	}
+
+	must(t, db.UpdateFields(ctx, coll, bson.M{"_id": "p1"}, bson.M{"level": 2}))
+	if err := db.UpdateFields(ctx, coll, bson.M{"_id": "p3"}, bson.M{"level": 2}); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("UpdateFields err = %v, want ErrNotFound", err)
+	}
+	all, err := db.FindAll[player](ctx, coll, bson.M{"level": bson.M{"$gte": 2}}, options.Find().SetSort(bson.D{{Key: "level", Value: -1}}))
+	must(t, err)
+	equal(t, fmt.Sprint(all), "[{p2 amy 4} {p1 tom 2}]")
+
+	must(t, db.DeleteOne(ctx, coll, bson.M{"_id": "p1"}))
+	if err := db.DeleteOne(ctx, coll, bson.M{"_id": "p1"}); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("DeleteOne err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	ctx := context.Background()
+	coll := dbtest.NewCollection()
+	for i := 1; i <= 45; i++ {
+		must(t, db.Insert(ctx, coll, player{fmt.Sprintf("p%02d", i), "bot", i % 5}))
+	}
+
+	level4 := bson.M{"level": bson.M{"$in": bson.A{4}}}
+	tests := []struct {
+		name   string
+		filter bson.M
+		query  db.PageQuery
+		first  string
+		items  int
+		total  int64
+		pages  int64
+	}{
+		{"Defaults", bson.M{}, db.PageQuery{}, "p01", 20, 45, 3},
+		{"LastPage", bson.M{}, db.PageQuery{Page: 3}, "p41", 5, 45, 3},
+		{"PastEnd", bson.M{}, db.PageQuery{Page: 4}, "", 0, 45, 3},
+		{"SizeCapped", bson.M{}, db.PageQuery{Size: 1000}, "p01", 45, 45, 1},
+		{"FilterSort", level4, db.PageQuery{Size: 5, Sort: bson.D{{Key: "_id", Value: -1}}}, "p44", 5, 9, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := db.FindPage[player](ctx, coll, tt.filter, tt.query)
+			must(t, err)
+			equal(t, len(res.Items), tt.items)
+			equal(t, res.Total, tt.total)
+			equal(t, res.Pages(), tt.pages)
+			if tt.items > 0 {
+				equal(t, res.Items[0].ID, tt.first)
+			}
+		})
+	}
+}
+
+func TestMongoError(t *testing.T) {
+	ctx := context.Background()
+	coll := dbtest.NewCollection()
+	down := errors.New("mongo down")
+	coll.SetError(down)
+	if _, err := db.FindPage[player](ctx, coll, bson.M{}, db.PageQuery{}); !errors.Is(err, down) {
+		t.Fatalf("FindPage err = %v, want %v", err, down)
+	}
+	if err := db.Upsert(ctx, coll, bson.M{"_id": "p1"}, player{ID: "p1"}); !errors.Is(err, down) {
+		t.Fatalf("Upsert err = %v, want %v", err, down)
+	}
+}
+
+func TestIndexModels(t *testing.T) {
+	order, models, err := db.IndexModels([]db.IndexSpec{
+		{Collection: "players", Keys: bson.D{{Key: "name", Value: 1}}, Unique: true, Name: "name_unique"},
+		{Collection: "logs", Keys: bson.D{{Key: "time", Value: 1}}, TTL: 7 * 24 * time.Hour},
+		{Collection: "players", Keys: bson.D{{Key: "guild", Value: 1}}, Sparse: true},
+	})
+	must(t, err)
+	equal(t, fmt.Sprint(order), "[players logs]")
+	equal(t, len(models["players"]), 2)
+
+	var opts options.IndexOptions
+	for _, fn := range models["players"][0].Options.List() {
+		must(t, fn(&opts))
+	}
+	equal(t, *opts.Name, "name_unique")
+	equal(t, *opts.Unique, true)
+
+	opts = options.IndexOptions{}
+	for _, fn := range models["logs"][0].Options.List() {
+		must(t, fn(&opts))
+	}
+	equal(t, *opts.ExpireAfterSeconds, int32(7*24*3600))
+
+	for _, bad := range []db.IndexSpec{
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+		{Collection: "players"},
+		{Collection: "logs", Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 1}}, TTL: time.Hour},
+	} {
+		if _, _, err := db.IndexModels([]db.IndexSpec{bad}); err == nil {
+			t.Fatalf("spec %+v should be rejected", bad)
+		}
+	}
+}
+
+// TestWithTransaction 事务中没有读写时不会访问服务端，可离线验证会话传递与错误返回
+func TestWithTransaction(t *testing.T) {
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100 * time.Millisecond))
+	must(t, err)
+	defer client.Disconnect(context.Background())
+	s := db.NewMongoStoreWithClient(client, "game")
+
+	var inSession bool
+	must(t, s.WithTransaction(context.Background(), func(ctx context.Context) error {
+		inSession = mongo.SessionFromContext(ctx) != nil
+		return nil
+	}))
+	equal(t, inSession, true)
+
+	boom := errors.New("boom")
+	calls := 0
+	err = s.WithTransaction(context.Background(), func(ctx context.Context) error {
+		calls++
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("WithTransaction err = %v, want %v", err, boom)
+	}
+	equal(t, calls, 1)
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	mrand "math/rand/v2"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound 缓存未命中（或命中空值缓存）。loader 返回该错误表示数据不存在，会触发空值缓存
+var ErrNotFound = errors.New("db: not found")
+
+// negativeValue 空值缓存的占位值，JSON 编码结果不会以 0 字节开头
+const negativeValue = "\x00nil"
+
+// CacheOptions 缓存配置
+type CacheOptions struct {
+	NegativeTTL time.Duration // loader 返回 ErrNotFound 时空值的缓存时长，0 表示不缓存空值
+	Jitter      float64       // TTL 随机浮动比例（0 ~ 1），避免大量 key 同时过期，默认 0.1，小于 0 表示不浮动
+}
+
+// Cache 类型化的 JSON 缓存，GetOrLoad 按 key 合并并发回源（singleflight）
+type Cache[T any] struct {
+	store *RedisStore
+	opts  CacheOptions
+	group singleflight.Group
+}
+
+// NewCache 创建类型化缓存
+func NewCache[T any](store *RedisStore, opts CacheOptions) *Cache[T] {
+	switch {
+	case opts.Jitter == 0:
+		opts.Jitter = 0.1
+	case opts.Jitter < 0:
+		opts.Jitter = 0
+	case opts.Jitter > 1:
+		opts.Jitter = 1
+	}
+	return &Cache[T]{store: store, opts: opts}
+}
+
+// Get 读取缓存，未命中或命中空值时返回 ErrNotFound
+func (c *Cache[T]) Get(ctx context.Context, key string) (T, error) {
+	v, _, err := c.get(ctx, key)
+	return v, err
+}
+
+// get 与 Get 相同，negative 表示命中的是空值缓存
+func (c *Cache[T]) get(ctx context.Context, key string) (v T, negative bool, err error) {
+	data, err := c.store.rdb.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return v, false, ErrNotFound
+	}
+	if err != nil {
+		return v, false, err
+	}
+	if string(data) == negativeValue {
+		return v, true, ErrNotFound
+	}
+	err = json.Unmarshal(data, &v)
+	return v, false, err
+}
+
+// Set 写入缓存，ttl 会按 Jitter 随机浮动
+func (c *Cache[T]) Set(ctx context.Context, key string, v T, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.store.rdb.Set(ctx, key, data, c.jitter(ttl)).Err()
+}
+
+// Invalidate 删除缓存
+func (c *Cache[T]) Invalidate(ctx context.Context, keys ...string) error {
+	_, err := c.store.Del(ctx, keys...)
+	return err
+}
+
+// GetOrLoad 读缓存，未命中时调用 loader 回源并写回缓存。
+// 同一 key 的并发回源只执行一次；loader 使用不随调用方取消的 ctx，避免一个调用方取消导致其他等待者一起失败。
+// 缓存读写出错时降级为直接回源，不影响结果
+func (c *Cache[T]) GetOrLoad(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	v, negative, err := c.get(ctx, key)
+	if err == nil || negative {
+		return v, err
+	}
+	if !errors.Is(err, ErrNotFound) {
+		log.Printf("cache get %s err: %v", key, err)
+	}
+
+	ch := c.group.DoChan(key, func() (any, error) {
+		loadCtx := context.WithoutCancel(ctx)
+		v, err := loader(loadCtx)
+		switch {
+		case err == nil:
+			if err := c.Set(loadCtx, key, v, ttl); err != nil {
+				log.Printf("cache set %s err: %v", key, err)
+			}
+		case errors.Is(err, ErrNotFound) && c.opts.NegativeTTL > 0:
+			if err := c.store.rdb.Set(loadCtx, key, negativeValue, c.jitter(c.opts.NegativeTTL)).Err(); err != nil {
+				log.Printf("cache set %s err: %v", key, err)
+			}
+		}
+		return v, err
+	})
+
+	select {
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	case res := <-ch:
+		v, _ := res.Val.(T)
+		return v, res.Err
+	}
+}
+
+func (c *Cache[T]) jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	delta := time.Duration(float64(ttl) * c.opts.Jitter)
+	if delta <= 0 {
+		return ttl
+	}
+	return ttl - delta + mrand.N(2*delta+1)
+}
+
+// defaultCaches 包级 GetOrLoad 按类型复用 Cache，保证同类型同 key 共享 singleflight
+var (
+	defaultCachesMu  sync.Mutex
+	defaultCaches    = make(map[reflect.Type]any)
+	defaultCacheOpts CacheOptions
+)
+
+// SetDefaultCacheOptions 设置包级 GetOrLoad 的缓存配置，如开启空值缓存的 NegativeTTL，默认为零值
+func SetDefaultCacheOptions(opts CacheOptions) {
+	defaultCachesMu.Lock()
+	defer defaultCachesMu.Unlock()
+	defaultCacheOpts = opts
+	clear(defaultCaches)
+}
+
+/*
+GetOrLoad 在默认实例上按 cache-aside 读取 key，未命中时回源并缓存，配置见 SetDefaultCacheOptions
+
+	user, err := db.GetOrLoad(ctx, "cache:user:1", time.Hour, func(ctx context.Context) (User, error) {
+		return loadUserFromMongo(ctx, 1)
+	})
+*/
+func GetOrLoad[T any](ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (T, error)) (T, error) {
+	return defaultCache[T]().GetOrLoad(ctx, key, ttl, loader)
+}
+
+func defaultCache[T any]() *Cache[T] {
+	typ := reflect.TypeFor[T]()
+	defaultCachesMu.Lock()
+	defer defaultCachesMu.Unlock()
+	if c, ok := defaultCaches[typ].(*Cache[T]); ok && c.store == def() {
+		return c
+	}
+	c := NewCache[T](def(), defaultCacheOpts)
+	defaultCaches[typ] = c
+	return c
+}
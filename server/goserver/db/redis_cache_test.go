@@ -0,0 +1,151 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestCacheJitter(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+
+	off := db.NewCache[user](s, db.CacheOptions{Jitter: -1})
+	must(t, off.Set(ctx, "off", user{"tom", 18}, time.Minute))
+	equal(t, mr.TTL("off"), time.Minute)
+
+	def := db.NewCache[user](s, db.CacheOptions{})
+	for i := 0; i < 20; i++ {
+		must(t, def.Set(ctx, "def", user{"tom", 18}, time.Minute))
+		if ttl := mr.TTL("def"); ttl < 54*time.Second || ttl > 66*time.Second {
+			t.Fatalf("ttl = %v, want within 10%% of 1m", ttl)
+		}
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	c := db.NewCache[user](s, db.CacheOptions{})
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (user, error) {
+		calls.Add(1)
+		<-release
+		return user{"amy", 20}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := c.GetOrLoad(ctx, "cache:user:1", time.Minute, loader)
+			if err != nil || u != (user{"amy", 20}) {
+				t.Errorf("GetOrLoad = %v, %v", u, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	equal(t, calls.Load(), int32(1))
+
+	// 已缓存，不再回源
+	u, err := c.GetOrLoad(ctx, "cache:user:1", time.Minute, loader)
+	must(t, err)
+	equal(t, u, user{"amy", 20})
+	equal(t, calls.Load(), int32(1))
+
+	must(t, c.Invalidate(ctx, "cache:user:1"))
+	if _, err := c.Get(ctx, "cache:user:1"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Get err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	c := db.NewCache[user](s, db.CacheOptions{NegativeTTL: time.Minute, Jitter: -1})
+
+	var calls int
+	loader := func(ctx context.Context) (user, error) {
+		calls++
+		return user{}, db.ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetOrLoad(ctx, "cache:user:404", time.Hour, loader); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("GetOrLoad err = %v, want ErrNotFound", err)
+		}
+	}
+	equal(t, calls, 1)
+	equal(t, mr.TTL("cache:user:404"), time.Minute)
+
+	mr.FastForward(time.Minute)
+	_, _ = c.GetOrLoad(ctx, "cache:user:404", time.Hour, loader)
+	equal(t, calls, 2)
+}
+
+func TestCacheLoaderError(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	c := db.NewCache[user](s, db.CacheOptions{NegativeTTL: time.Minute})
+
+	boom := errors.New("mongo down")
+	_, err := c.GetOrLoad(ctx, "k", time.Hour, func(ctx context.Context) (user, error) { return user{}, boom })
+	if !errors.Is(err, boom) {
+		t.Fatalf("GetOrLoad err = %v, want %v", err, boom)
+	}
+	// 其他错误不写空值缓存
+	equal(t, mr.Exists("k"), false)
+}
+
+// TestGetOrLoadDefault 包级 GetOrLoad 按类型区分 Cache
+func TestGetOrLoadDefault(t *testing.T) {
+	ctx := context.Background()
+	dbtest.InitDefault(t)
+
+	u, err := db.GetOrLoad(ctx, "u", time.Minute, func(ctx context.Context) (user, error) { return user{"tom", 18}, nil })
+	must(t, err)
+	equal(t, u, user{"tom", 18})
+	n, err := db.GetOrLoad(ctx, "n", time.Minute, func(ctx context.Context) (int, error) { return 7, nil })
+	must(t, err)
+	equal(t, n, 7)
+	u, err = db.GetOrLoad(ctx, "u", time.Minute, func(ctx context.Context) (user, error) { return user{}, errors.New("cached, not called") })
+	must(t, err)
+	equal(t, u, user{"tom", 18})
+}
+
+// TestGetOrLoadDefaultNegative 包级 GetOrLoad 按 SetDefaultCacheOptions 缓存空值
+func TestGetOrLoadDefaultNegative(t *testing.T) {
+	ctx := context.Background()
+	_, mr := dbtest.InitDefault(t)
+	db.SetDefaultCacheOptions(db.CacheOptions{NegativeTTL: time.Minute, Jitter: -1})
+	defer db.SetDefaultCacheOptions(db.CacheOptions{})
+
+	var calls int
+	loader := func(ctx context.Context) (user, error) {
+		calls++
+		return user{}, db.ErrNotFound
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.GetOrLoad(ctx, "cache:user:404", time.Hour, loader); !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("GetOrLoad err = %v, want ErrNotFound", err)
+		}
+	}
+	equal(t, calls, 1)
+	equal(t, mr.TTL("cache:user:404"), time.Minute)
+
+	// 恢复默认配置后不再缓存空值
+	db.SetDefaultCacheOptions(db.CacheOptions{})
+	_, _ = db.GetOrLoad(ctx, "cache:user:405", time.Hour, loader)
+	equal(t, calls, 2)
+	equal(t, mr.Exists("cache:user:405"), false)
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotInitialized 未调用 Init / SetDefault 就使用了包级函数
+var ErrNotInitialized = errors.New("db: default redis store not initialized, call db.Init first")
+
+// defaultStore 包级函数使用的默认实例，由 Init 创建
+var defaultStore *RedisStore
+
+// uninitialized 未初始化时包级函数使用的占位实例，所有命令都返回 ErrNotInitialized
+var uninitialized = newUninitializedStore()
+
+func newUninitializedStore() *RedisStore {
+	rdb := redis.NewClient(&redis.Options{Addr: "uninitialized:0", MaxRetries: -1})
+	rdb.AddHook(notInitializedHook{})
+	return &RedisStore{rdb: rdb}
+}
+
+type notInitializedHook struct{}
+
+func (notInitializedHook) DialHook(redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, ErrNotInitialized
+	}
+}
+
+func (notInitializedHook) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		cmd.SetErr(ErrNotInitialized)
+		return ErrNotInitialized
+	}
+}
+
+func (notInitializedHook) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			cmd.SetErr(ErrNotInitialized)
+		}
+		return ErrNotInitialized
+	}
+}
+
+// def 返回默认实例，未初始化时返回占位实例，包级函数以 ErrNotInitialized 失败而不是 panic
+func def() *RedisStore {
+	if s := defaultStore; s != nil {
+		return s
+	}
+	return uninitialized
+}
+
+// Init 初始化默认 Redis 实例，PING 不通时返回错误
+func Init(ctx context.Context, cfg Config) error {
+	s, err := NewRedisStore(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defaultStore = s
+	return nil
+}
+
+// SetDefault 替换默认实例，用于测试或由调用方自行创建实例的场景
+func SetDefault(s *RedisStore) {
+	defaultStore = s
+}
+
+// Default 返回默认实例，未初始化时为 nil
+func Default() *RedisStore {
+	return defaultStore
+}
+
+// Instrument 为默认实例添加监控
+func Instrument(opts HookOptions) error {
+	if defaultStore == nil {
+		return ErrNotInitialized
+	}
+	return defaultStore.Instrument(opts)
+}
+
+// ---------------- String ----------------
+
+// Set 设置 key
+func Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return def().Set(ctx, key, value, expiration)
+}
+
+// Get 获取 key
+func Get(ctx context.Context, key string) (string, error) {
+	return def().Get(ctx, key)
+}
+
+// Incr 自增
+func Incr(ctx context.Context, key string) (int64, error) {
+	return def().Incr(ctx, key)
+}
+
+// Decr 自减
+func Decr(ctx context.Context, key string) (int64, error) {
+	return def().Decr(ctx, key)
+}
+
+// ---------------- Hash ----------------
+
+func HSet(ctx context.Context, key string, values ...interface{}) error {
+	return def().HSet(ctx, key, values...)
+}
+
+func HGet(ctx context.Context, key, field string) (string, error) {
+	return def().HGet(ctx, key, field)
+}
+
+func HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return def().HGetAll(ctx, key)
+}
+
+// ---------------- List ----------------
+
+func LPush(ctx context.Context, key string, values ...interface{}) error {
+	return def().LPush(ctx, key, values...)
+}
+
+func RPush(ctx context.Context, key string, values ...interface{}) error {
+	return def().RPush(ctx, key, values...)
+}
+
+func LPop(ctx context.Context, key string) (string, error) {
+	return def().LPop(ctx, key)
+}
+
+func LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return def().LRange(ctx, key, start, stop)
+}
+
+// ---------------- Set ----------------
+
+func SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return def().SAdd(ctx, key, members...)
+}
+
+func SMembers(ctx context.Context, key string) ([]string, error) {
+	return def().SMembers(ctx, key)
+}
+
+func SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return def().SIsMember(ctx, key, member)
+}
+
+// ---------------- ZSet ----------------
+
+func ZAdd(ctx context.Context, key string, members ...redis.Z) error {
+	return def().ZAdd(ctx, key, members...)
+}
+
+func ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return def().ZRangeWithScores(ctx, key, start, stop)
+}
+
+func ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return def().ZRevRangeWithScores(ctx, key, start, stop)
+}
+
+// ---------------- 分布式锁 ----------------
+
+// TryLock 尝试获取锁（过期时间必须设置）
+//
+// Deprecated: 使用 NewLock，带 token 校验与自动续期
+func TryLock(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return def().TryLock(ctx, key, value, expiration)
+}
+
+// Unlock 释放锁（简单版，没做 value 校验）
+//
+// Deprecated: 使用 NewLock，释放时校验 token
+func Unlock(ctx context.Context, key string) error {
+	return def().Unlock(ctx, key)
+}
+
+// NewLock 在默认实例上创建分布式锁
+func NewLock(key string, opts LockOptions) *Lock {
+	return def().NewLock(key, opts)
+}
+
+// NewLeaderboard 在默认实例上创建排行榜
+func NewLeaderboard(name string, opts LeaderboardOptions) *Leaderboard {
+	return def().NewLeaderboard(name, opts)
+}
+
+// ---------------- 发布订阅 ----------------
+
+func Publish(ctx context.Context, channel, msg string) error {
+	return def().Publish(ctx, channel, msg)
+}
+
+func Subscribe(ctx context.Context, channel string) *redis.PubSub {
+	return def().Subscribe(ctx, channel)
+}
+
+// NewEventBus 在默认实例上创建事件总线
+func NewEventBus(opts EventBusOptions) *EventBus {
+	return def().NewEventBus(opts)
+}
+
+// NewWallet 在默认实例上创建钱包
+func NewWallet(opts WalletOptions) *Wallet {
+	return def().NewWallet(opts)
+}
+
+// NewQueue 在默认实例上创建任务队列
+func NewQueue(name string, opts QueueOptions) *Queue {
+	return def().NewQueue(name, opts)
+}
+
+// NewSlidingWindowLimiter 在默认实例上创建滑动窗口限流器
+func NewSlidingWindowLimiter(prefix string, limit int64, window time.Duration) *SlidingWindowLimiter {
+	return def().NewSlidingWindowLimiter(prefix, limit, window)
+}
+
+// NewTokenBucketLimiter 在默认实例上创建令牌桶限流器
+func NewTokenBucketLimiter(prefix string, rate float64, burst int64) *TokenBucketLimiter {
+	return def().NewTokenBucketLimiter(prefix, rate, burst)
+}
+
+// NewCounter 在默认实例上创建统计计数器
+func NewCounter(name string, opts CounterOptions) *Counter {
+	return def().NewCounter(name, opts)
+}
+
+// NewPresence 在默认实例上创建在线状态注册表
+func NewPresence(nodeID string, opts PresenceOptions) *Presence {
+	return def().NewPresence(nodeID, opts)
+}
+
+// ---------------- 事务与流水线 ----------------
+
+// Pipelined 在默认实例上以流水线执行 fn 中的命令
+func Pipelined(ctx context.Context, fn func(pipe Pipe) error) ([]redis.Cmder, error) {
+	return def().Pipelined(ctx, fn)
+}
+
+// TxPipelined 在默认实例上以 MULTI/EXEC 原子执行 fn 中的命令
+func TxPipelined(ctx context.Context, fn func(pipe Pipe) error) ([]redis.Cmder, error) {
+	return def().TxPipelined(ctx, fn)
+}
+
+// WatchTx 在默认实例上执行乐观锁事务，冲突时自动重试
+func WatchTx(ctx context.Context, keys []string, fn func(tx Tx) error) error {
+	return def().WatchTx(ctx, keys, fn)
+}
+
+// ---------------- key 命名空间 ----------------
+
+// AuditKeys 在默认实例上审计命名空间下的 key
+func AuditKeys(ctx context.Context, ks *Keyspace, opts AuditOptions) ([]KeyIssue, error) {
+	return def().AuditKeys(ctx, ks, opts)
+}
+
+// ---------------- 清除缓存 ----------------
+
+// Del 删除一个或多个 key
+func Del(ctx context.Context, keys ...string) (int64, error) {
+	return def().Del(ctx, keys...)
+}
+
+// Expire 设置 key 过期时间
+func Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return def().Expire(ctx, key, expiration)
+}
+
+// TTL 查看 key 剩余过期时间
+func TTL(ctx context.Context, key string) (time.Duration, error) {
+	return def().TTL(ctx, key)
+}
+
+// DelByPrefix 按前缀删除缓存
+func DelByPrefix(ctx context.Context, prefix string) (int64, error) {
+	return def().DelByPrefix(ctx, prefix)
+}
+
+// DelByPrefixWith 按前缀删除缓存，支持 dry-run 与进度回调
+func DelByPrefixWith(ctx context.Context, prefix string, opts DelOptions) (DelResult, error) {
+	return def().DelByPrefixWith(ctx, prefix, opts)
+}
+
+// FlushDB 清空当前数据库，未开启 AllowFlush 时返回 ErrFlushDisabled
+func FlushDB(ctx context.Context) error {
+	return def().FlushDB(ctx)
+}
+
+// FlushAll 清空所有数据库，未开启 AllowFlush 时返回 ErrFlushDisabled（生产环境慎用⚠️）
+func FlushAll(ctx context.Context) error {
+	return def().FlushAll(ctx)
+}
+
+// ---------------- JSON ----------------
+
+// SetJSON 存储结构体（自动序列化）
+func SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return def().SetJSON(ctx, key, value, expiration)
+}
+
+// GetJSON 获取结构体（自动反序列化）
+func GetJSON(ctx context.Context, key string, dest interface{}) error {
+	return def().GetJSON(ctx, key, dest)
+}
+
+// HSetJSON 将结构体存储到 Hash
+func HSetJSON(ctx context.Context, key string, field string, value interface{}) error {
+	return def().HSetJSON(ctx, key, field, value)
+}
+
+// HGetJSON 从 Hash 中取结构体
+func HGetJSON(ctx context.Context, key, field string, dest interface{}) error {
+	return def().HGetJSON(ctx, key, field, dest)
+}
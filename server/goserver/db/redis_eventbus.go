@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EventBusOptions 事件总线配置，零值字段使用默认值
+type EventBusOptions struct {
+	Prefix string // channel / stream key 前缀，默认 "event:"
+
+	// Stream 为 true 时使用 Redis Streams + 消费组，事件至少投递一次；
+	// 否则使用 Pub/Sub，节点离线期间的事件会丢失
+	Stream       bool
+	Group        string        // 消费组名，同组节点分摊消费，Stream 模式必填
+	Consumer     string        // 消费者名，默认 hostname-pid
+	MaxLen       int64         // stream 近似最大长度，默认 10000
+	Block        time.Duration // XREADGROUP 阻塞时长，默认 5s
+	ClaimIdle    time.Duration // 超过该时长未 ACK 的事件会被重新认领投递，默认 1min
+	RetryBackoff time.Duration // 断线后重新订阅的等待时间，默认 1s
+}
+
+type eventHandler func(ctx context.Context, data json.RawMessage) error
+
+// eventEnvelope 事件在 Redis 中的存储格式
+type eventEnvelope struct {
+	Topic string          `json:"topic"`
+	Time  int64           `json:"time"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// errEventDecode 事件无法解析，重试也不会成功，Stream 模式下直接 ACK
+type errEventDecode struct{ err error }
+
+func (e errEventDecode) Error() string { return "decode event: " + e.err.Error() }
+
+/*
+EventBus 发布/订阅类型化的 JSON 事件，Redis 故障切换后自动重新订阅。
+
+Stream 模式下所有主题的 stream key 带相同的 hash tag，集群模式下位于同一 slot，
+一次 XREADGROUP 即可读取全部主题
+
+	event:{bus}:<topic>   Stream 模式
+	event:<topic>         Pub/Sub 模式的 channel
+*/
+type EventBus struct {
+	store *RedisStore
+	opts  EventBusOptions
+
+	mu       sync.RWMutex
+	handlers map[string][]eventHandler
+}
+
+// NewEventBus 创建事件总线
+func (s *RedisStore) NewEventBus(opts EventBusOptions) *EventBus {
+	if opts.Prefix == "" {
+		opts.Prefix = "event:"
+	}
+	if opts.Consumer == "" {
+		host, _ := os.Hostname()
+		opts.Consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if opts.MaxLen <= 0 {
+		opts.MaxLen = 10000
+	}
+	if opts.Block <= 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = time.Minute
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	return &EventBus{store: s, opts: opts, handlers: make(map[string][]eventHandler)}
+}
+
+/*
+On 注册事件处理函数，事件数据自动反序列化为 T，需在 Run 之前注册。
+Stream 模式下处理函数返回错误时事件不会 ACK，ClaimIdle 之后重新投递
+
+	db.On(bus, "player.login", func(ctx context.Context, ev LoginEvent) error {
+		return nil
+	})
+*/
+func On[T any](b *EventBus, topic string, fn func(ctx context.Context, ev T) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], func(ctx context.Context, data json.RawMessage) error {
+		var ev T
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return errEventDecode{err}
+		}
+		return fn(ctx, ev)
+	})
+}
+
+// Publish 发布事件
+func (b *EventBus) Publish(ctx context.Context, topic string, ev any) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(eventEnvelope{Topic: topic, Time: time.Now().UnixMilli(), Data: data})
+	if err != nil {
+		return err
+	}
+	if !b.opts.Stream {
+		return b.store.rdb.Publish(ctx, b.opts.Prefix+topic, msg).Err()
+	}
+	return b.store.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: b.streamKey(topic),
+		MaxLen: b.opts.MaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"event": msg},
+	}).Err()
+}
+
+// Run 订阅所有已注册的主题并分发事件，阻塞直到 ctx 取消
+func (b *EventBus) Run(ctx context.Context) error {
+	b.mu.RLock()
+	topics := make([]string, 0, len(b.handlers))
+	for topic := range b.handlers {
+		topics = append(topics, topic)
+	}
+	b.mu.RUnlock()
+	if len(topics) == 0 {
+		return errors.New("db: event bus has no handlers")
+	}
+
+	for {
+		var err error
+		if b.opts.Stream {
+			err = b.runStream(ctx, topics)
+		} else {
+			err = b.runPubSub(ctx, topics)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("event bus err: %v, resubscribe in %v", err, b.opts.RetryBackoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(b.opts.RetryBackoff):
+		}
+	}
+}
+
+func (b *EventBus) dispatch(ctx context.Context, topic string, msg string) error {
+	var env eventEnvelope
+	if err := json.Unmarshal([]byte(msg), &env); err != nil {
+		return errEventDecode{err}
+	}
+	b.mu.RLock()
+	handlers := b.handlers[topic]
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, h := range handlers {
+		if err := h(ctx, env.Data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ---------------- Pub/Sub ----------------
+
+func (b *EventBus) runPubSub(ctx context.Context, topics []string) error {
+	channels := make([]string, len(topics))
+	for i, topic := range topics {
+		channels[i] = b.opts.Prefix + topic
+	}
+	ps := b.store.rdb.Subscribe(ctx, channels...)
+	defer ps.Close()
+	// ReceiveMessage 不响应 ctx 取消，关闭订阅使其返回
+	stop := context.AfterFunc(ctx, func() { ps.Close() })
+	defer stop()
+	// 等待订阅确认，连接失败时立即返回重试
+	if _, err := ps.Receive(ctx); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := ps.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		topic := strings.TrimPrefix(msg.Channel, b.opts.Prefix)
+		if err := b.dispatch(ctx, topic, msg.Payload); err != nil {
+			log.Printf("event %s handle err: %v", topic, err)
+		}
+	}
+}
+
+// ---------------- Streams ----------------
+
+// streamPrefix Stream 模式的 key 前缀，hash tag 保证多个主题可以在同一条 XREADGROUP 中读取
+func (b *EventBus) streamPrefix() string {
+	return b.opts.Prefix + "{bus}:"
+}
+
+func (b *EventBus) streamKey(topic string) string {
+	return b.streamPrefix() + topic
+}
+
+func (b *EventBus) runStream(ctx context.Context, topics []string) error {
+	if b.opts.Group == "" {
+		return errors.New("db: event bus stream mode requires Group")
+	}
+	streams := make([]string, 0, len(topics)*2)
+	for _, topic := range topics {
+		key := b.streamKey(topic)
+		err := b.store.rdb.XGroupCreateMkStream(ctx, key, b.opts.Group, "$").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+		streams = append(streams, key)
+	}
+	for range topics {
+		streams = append(streams, ">")
+	}
+
+	var lastClaim time.Time
+	for {
+		if time.Since(lastClaim) >= b.opts.ClaimIdle/2 {
+			for _, topic := range topics {
+				if err := b.claimStream(ctx, topic); err != nil {
+					return err
+				}
+			}
+			lastClaim = time.Now()
+		}
+
+		res, err := b.store.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    b.opts.Group,
+			Consumer: b.opts.Consumer,
+			Streams:  streams,
+			Count:    100,
+			Block:    b.opts.Block,
+		}).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, stream := range res {
+			b.handleStream(ctx, stream.Stream, stream.Messages)
+		}
+	}
+}
+
+// claimStream 认领其他消费者（可能已宕机）超时未 ACK 的事件
+func (b *EventBus) claimStream(ctx context.Context, topic string) error {
+	key := b.streamKey(topic)
+	start := "0-0"
+	for {
+		msgs, next, err := b.store.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   key,
+			Group:    b.opts.Group,
+			Consumer: b.opts.Consumer,
+			MinIdle:  b.opts.ClaimIdle,
+			Start:    start,
+			Count:    100,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		b.handleStream(ctx, key, msgs)
+		// 一批可能全是已删除的事件而为空，只有 next 为 0-0 时才扫描完
+		if next == "0-0" {
+			return nil
+		}
+		start = next
+	}
+}
+
+func (b *EventBus) handleStream(ctx context.Context, key string, msgs []redis.XMessage) {
+	topic := strings.TrimPrefix(key, b.streamPrefix())
+	for _, msg := range msgs {
+		payload, _ := msg.Values["event"].(string)
+		err := b.dispatch(ctx, topic, payload)
+		if err != nil {
+			if !isDecodeOnly(err) {
+				// 不 ACK，等待重新投递
+				log.Printf("event %s %s handle err: %v", topic, msg.ID, err)
+				continue
+			}
+			log.Printf("event %s %s dropped: %v", topic, msg.ID, err)
+		}
+		if err := b.store.rdb.XAck(ctx, key, b.opts.Group, msg.ID).Err(); err != nil {
+			log.Printf("event %s %s ack err: %v", topic, msg.ID, err)
+		}
+	}
+}
+
+// isDecodeOnly 所有处理函数的错误都是解析失败（重试也不会成功）
+func isDecodeOnly(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			if !isDecodeOnly(e) {
+				return false
+			}
+		}
+		return true
+	}
+	var decodeErr errEventDecode
+	return errors.As(err, &decodeErr)
+}
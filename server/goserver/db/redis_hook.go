@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HookOptions 监控配置，零值字段使用默认值
+type HookOptions struct {
+	Name          string                // 实例名，作为指标的 instance 标签，默认 "default"
+	SlowThreshold time.Duration         // 慢命令阈值，超过时打印日志，默认 100ms，小于 0 时关闭
+	MaxArgLen     int                   // 慢日志中单个参数的最大长度，默认 64
+	Registerer    prometheus.Registerer // 指标注册器，默认 prometheus.DefaultRegisterer
+	Tracer        trace.Tracer          // 默认使用全局 TracerProvider，未配置时不产生开销
+}
+
+// redisMetrics 同一注册器上的所有实例共享，以 instance 标签区分
+type redisMetrics struct {
+	duration *prometheus.HistogramVec
+	slow     *prometheus.CounterVec
+}
+
+func newRedisMetrics(reg prometheus.Registerer) (*redisMetrics, error) {
+	m := &redisMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "redis_command_duration_seconds",
+			Help:    "Redis command latency.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"instance", "cmd", "status"}),
+		slow: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "redis_slow_commands_total",
+			Help: "Redis commands slower than the slow threshold.",
+		}, []string{"instance", "cmd"}),
+	}
+	var err error
+	if m.duration, err = registerOrExisting(reg, m.duration); err != nil {
+		return nil, err
+	}
+	if m.slow, err = registerOrExisting(reg, m.slow); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// registerOrExisting 多个实例注册同名指标时复用已注册的那个
+func registerOrExisting[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+type redisHook struct {
+	opts    HookOptions
+	metrics *redisMetrics
+}
+
+/*
+Instrument 为实例添加监控：按命令统计耗时直方图，超过 SlowThreshold 的命令打印日志（参数已脱敏），
+并为每条命令 / pipeline 创建 OpenTelemetry span。应在创建实例后立即调用，只调用一次
+
+	_ = db.Default().Instrument(db.HookOptions{SlowThreshold: 50 * time.Millisecond})
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", db.MetricsHandler())
+*/
+func (s *RedisStore) Instrument(opts HookOptions) error {
+	if opts.Name == "" {
+		opts.Name = "default"
+	}
+	if opts.SlowThreshold == 0 {
+		opts.SlowThreshold = 100 * time.Millisecond
+	}
+	if opts.MaxArgLen <= 0 {
+		opts.MaxArgLen = 64
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	if opts.Tracer == nil {
+		opts.Tracer = otel.Tracer("goserver/db")
+	}
+	m, err := newRedisMetrics(opts.Registerer)
+	if err != nil {
+		return err
+	}
+	s.rdb.AddHook(&redisHook{opts: opts, metrics: m})
+	return nil
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出默认注册器中的所有指标
+func MetricsHandler() http.Handler {
+	return promhttp.Handler()
+}
+
+func (h *redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		name := cmd.FullName()
+		ctx, span := h.opts.Tracer.Start(ctx, "redis "+name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.String("db.operation", name),
+			))
+		start := time.Now()
+		err := next(ctx, cmd)
+		elapsed := time.Since(start)
+
+		h.observe(name, elapsed, err)
+		if h.slow(elapsed) {
+			h.metrics.slow.WithLabelValues(h.opts.Name, name).Inc()
+			log.Printf("redis slow command %v: %s", elapsed, h.sanitize(cmd))
+		}
+		endSpan(span, err)
+		return err
+	}
+}
+
+func (h *redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := h.opts.Tracer.Start(ctx, "redis pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String("db.system", "redis"),
+				attribute.Int("db.redis.num_cmd", len(cmds)),
+			))
+		start := time.Now()
+		err := next(ctx, cmds)
+		elapsed := time.Since(start)
+
+		h.observe("pipeline", elapsed, err)
+		if h.slow(elapsed) {
+			h.metrics.slow.WithLabelValues(h.opts.Name, "pipeline").Inc()
+			summary := make([]string, 0, min(len(cmds), 5))
+			for _, cmd := range cmds[:min(len(cmds), 5)] {
+				summary = append(summary, h.sanitize(cmd))
+			}
+			log.Printf("redis slow pipeline %v (%d cmds): %s", elapsed, len(cmds), strings.Join(summary, "; "))
+		}
+		endSpan(span, err)
+		return err
+	}
+}
+
+func (h *redisHook) slow(elapsed time.Duration) bool {
+	return h.opts.SlowThreshold > 0 && elapsed >= h.opts.SlowThreshold
+}
+
+func (h *redisHook) observe(name string, elapsed time.Duration, err error) {
+	status := "ok"
+	if isRedisError(err) {
+		status = "error"
+	}
+	h.metrics.duration.WithLabelValues(h.opts.Name, name, status).Observe(elapsed.Seconds())
+}
+
+// isRedisError redis.Nil 表示 key 不存在，不算错误
+func isRedisError(err error) bool {
+	return err != nil && !errors.Is(err, redis.Nil)
+}
+
+func endSpan(span trace.Span, err error) {
+	if isRedisError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sensitiveCommands 参数中可能含密码的命令，只保留命令名
+var sensitiveCommands = map[string]bool{
+	"auth":    true,
+	"hello":   true,
+	"migrate": true,
+	"config":  true,
+}
+
+// sanitize 命令的日志形式：敏感命令隐藏所有参数，其余参数截断到 MaxArgLen，二进制数据只显示长度
+func (h *redisHook) sanitize(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) == 0 {
+		return ""
+	}
+	name := strings.ToLower(fmt.Sprint(args[0]))
+	if sensitiveCommands[name] {
+		return name + " [redacted]"
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, arg := range args[1:] {
+		b.WriteByte(' ')
+		var s string
+		switch v := arg.(type) {
+		case []byte:
+			fmt.Fprintf(&b, "<%d bytes>", len(v))
+			continue
+		case string:
+			s = v
+		default:
+			s = fmt.Sprint(v)
+		}
+		if len(s) > h.opts.MaxArgLen {
+			s = fmt.Sprintf("%s...(%d bytes)", s[:h.opts.MaxArgLen], len(s))
+		}
+		b.WriteString(s)
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+package db_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/redis/go-redis/v9"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+// findMetric 返回 name 指标中标签完全匹配 labels 的样本，不存在时返回 nil
+func findMetric(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	must(t, err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range f.GetMetric() {
+			if len(m.GetLabel()) != len(labels) {
+				continue
+			}
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue next
+				}
+			}
+			return m
+		}
+	}
+	return nil
+}
+
+func commandCount(t *testing.T, reg *prometheus.Registry, cmd, status string) uint64 {
+	t.Helper()
+	m := findMetric(t, reg, "redis_command_duration_seconds",
+		map[string]string{"instance": "test", "cmd": cmd, "status": status})
+	if m == nil {
+		return 0
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+// captureLog 在测试期间把标准日志输出到返回的 buffer
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(old) })
+	return &buf
+}
+
+func TestInstrumentMetrics(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	reg := prometheus.NewRegistry()
+	must(t, s.Instrument(db.HookOptions{Name: "test", Registerer: reg, SlowThreshold: -1}))
+
+	must(t, s.Set(ctx, "k", "v", 0))
+	_, err := s.Get(ctx, "k")
+	must(t, err)
+	// key 不存在不算错误
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, redis.Nil) {
+		t.Fatalf("err = %v, want redis.Nil", err)
+	}
+	mr.SetError("boom")
+	if _, err := s.Get(ctx, "k"); err == nil {
+		t.Fatal("want error")
+	}
+	mr.SetError("")
+
+	equal(t, commandCount(t, reg, "set", "ok"), uint64(1))
+	equal(t, commandCount(t, reg, "get", "ok"), uint64(2))
+	equal(t, commandCount(t, reg, "get", "error"), uint64(1))
+	if m := findMetric(t, reg, "redis_slow_commands_total", map[string]string{"instance": "test", "cmd": "get"}); m != nil {
+		t.Fatalf("slow counter = %v, want none with SlowThreshold < 0", m.GetCounter().GetValue())
+	}
+}
+
+func TestInstrumentPipeline(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	reg := prometheus.NewRegistry()
+	must(t, s.Instrument(db.HookOptions{Name: "test", Registerer: reg, SlowThreshold: -1}))
+
+	_, err := s.Pipelined(ctx, func(p db.Pipe) error {
+		p.Set(ctx, "a", 1, 0)
+		p.Incr(ctx, "a")
+		return nil
+	})
+	must(t, err)
+	equal(t, commandCount(t, reg, "pipeline", "ok"), uint64(1))
+	equal(t, commandCount(t, reg, "set", "ok"), uint64(0))
+}
+
+func TestInstrumentSlowLog(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	reg := prometheus.NewRegistry()
+	must(t, s.Instrument(db.HookOptions{Name: "test", Registerer: reg, SlowThreshold: time.Nanosecond, MaxArgLen: 8}))
+	buf := captureLog(t)
+
+	must(t, s.Set(ctx, "k", strings.Repeat("x", 100), 0))
+	m := findMetric(t, reg, "redis_slow_commands_total", map[string]string{"instance": "test", "cmd": "set"})
+	if m == nil {
+		t.Fatal("slow counter not found")
+	}
+	equal(t, m.GetCounter().GetValue(), 1.0)
+	if got := buf.String(); !strings.Contains(got, "set k xxxxxxxx...(100 bytes)") {
+		t.Fatalf("log = %q, want truncated args", got)
+	}
+}
+
+func TestInstrumentSharedRegistry(t *testing.T) {
+	ctx := context.Background()
+	a, _ := dbtest.NewStore(t)
+	b, _ := dbtest.NewStore(t)
+	reg := prometheus.NewRegistry()
+	must(t, a.Instrument(db.HookOptions{Name: "test", Registerer: reg, SlowThreshold: -1}))
+	// 同一注册器上的第二个实例复用已注册的指标
+	must(t, b.Instrument(db.HookOptions{Name: "test", Registerer: reg, SlowThreshold: -1}))
+
+	must(t, a.Set(ctx, "k", "v", 0))
+	must(t, b.Set(ctx, "k", "v", 0))
+	equal(t, commandCount(t, reg, "set", "ok"), uint64(2))
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		args []interface{}
+		want string
+	}{
+		{[]interface{}{"AUTH", "user", "secret"}, "auth [redacted]"},
+		{[]interface{}{"config", "set", "requirepass", "secret"}, "config [redacted]"},
+		{[]interface{}{"get", "k"}, "get k"},
+		{[]interface{}{"set", "k", []byte("secret")}, "set k <6 bytes>"},
+		{[]interface{}{"set", "k", "0123456789"}, "set k 01234567...(10 bytes)"},
+		{[]interface{}{"expire", "k", 60}, "expire k 60"},
+	}
+	for _, tt := range tests {
+		equal(t, db.Sanitize(8, tt.args...), tt.want)
+	}
+}
@@ -0,0 +1,272 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// KeyType key 的 Redis 数据类型，与 TYPE 命令的返回值一致
+type KeyType string
+
+const (
+	KeyString KeyType = "string"
+	KeyHash   KeyType = "hash"
+	KeyList   KeyType = "list"
+	KeySet    KeyType = "set"
+	KeyZSet   KeyType = "zset"
+	KeyStream KeyType = "stream"
+)
+
+/*
+Keyspace 统一的 key 命名空间，key 以 "<env>:<app>:" 开头，避免不同环境、不同服务共用 Redis 时互相覆盖。
+业务 key 通过 Define 声明类型和默认 TTL，启动时可用 AuditKeys 检查线上数据是否符合声明
+
+	var (
+		Keys      = db.NewKeyspace("prod", "coin")
+		UserCache = Keys.Define("cache:user", db.KeyString, time.Hour)
+		OrderLock = Keys.Define("lock:order", db.KeyString, 10*time.Second)
+		Bag       = Keys.Define("bag", db.KeyHash, 0) // 0 表示永久保存
+	)
+
+	_ = db.SetJSON(ctx, UserCache.Key(uid), user, UserCache.TTL)  // prod:coin:cache:user:1
+
+Wallet、Queue、Leaderboard 等内置组件默认使用不带命名空间的固定前缀（wallet:、queue:、lb: 等），
+AuditKeys 扫描不到。需要纳入命名空间时用 Subsystem 登记并把返回的前缀传给组件：
+
+	wallet := store.NewWallet(db.WalletOptions{Prefix: Keys.Subsystem("wallet")}) // prod:coin:wallet:{uid}
+*/
+type Keyspace struct {
+	prefix string
+
+	mu   sync.RWMutex
+	defs map[string]*KeyDef
+}
+
+// NewKeyspace 创建命名空间，env 如 dev/test/prod，app 为服务名
+func NewKeyspace(env, app string) *Keyspace {
+	return &Keyspace{prefix: env + ":" + app + ":", defs: make(map[string]*KeyDef)}
+}
+
+// Prefix 命名空间前缀
+func (ks *Keyspace) Prefix() string {
+	return ks.prefix
+}
+
+// KeyDef 一类 key 的声明
+type KeyDef struct {
+	Name string        // 名称，如 cache:user
+	Type KeyType       // 数据类型，为空时不校验
+	TTL  time.Duration // 默认过期时间，0 表示永久保存
+
+	base string
+}
+
+// Define 声明一类 key，重复声明同名 key 会 panic，应在包初始化时调用
+func (ks *Keyspace) Define(name string, typ KeyType, ttl time.Duration) *KeyDef {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if _, ok := ks.defs[name]; ok {
+		panic(fmt.Sprintf("db: key %q defined twice", name))
+	}
+	d := &KeyDef{Name: name, Type: typ, TTL: ttl, base: ks.prefix + name}
+	ks.defs[name] = d
+	return d
+}
+
+// Subsystem 登记由内置组件管理的一类 key 并返回其前缀（以 ":" 结尾），用作组件的 Prefix 选项。
+// 组件内部有多种类型和过期策略的 key，审计时只确认其已登记，不校验类型与 TTL
+func (ks *Keyspace) Subsystem(name string) string {
+	return ks.Define(name, "", 0).base + ":"
+}
+
+// Defs 已声明的所有 key，按名称排序
+func (ks *Keyspace) Defs() []*KeyDef {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	defs := make([]*KeyDef, 0, len(ks.defs))
+	for _, d := range ks.defs {
+		defs = append(defs, d)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// Lookup 查找 key 所属的声明，多个声明匹配时取名称最长的，没有匹配时返回 nil
+func (ks *Keyspace) Lookup(key string) *KeyDef {
+	name, ok := strings.CutPrefix(key, ks.prefix)
+	if !ok {
+		return nil
+	}
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	for {
+		if d, ok := ks.defs[name]; ok {
+			return d
+		}
+		i := strings.LastIndexByte(name, ':')
+		if i < 0 {
+			return nil
+		}
+		name = name[:i]
+	}
+}
+
+// Key 拼接完整 key，parts 以 ":" 连接，如 Key(1001) -> prod:coin:cache:user:1001
+func (d *KeyDef) Key(parts ...any) string {
+	if len(parts) == 0 {
+		return d.base
+	}
+	var b strings.Builder
+	b.WriteString(d.base)
+	for _, p := range parts {
+		b.WriteByte(':')
+		fmt.Fprint(&b, p)
+	}
+	return b.String()
+}
+
+// Pattern 匹配该类所有 key 的 SCAN 模式
+func (d *KeyDef) Pattern() string {
+	return d.base + ":*"
+}
+
+// ---------------- 启动审计 ----------------
+
+// KeyIssue 审计发现的问题
+type KeyIssue struct {
+	Key     string
+	Def     string // 所属声明，未声明时为空
+	Problem string // no ttl / type mismatch / undefined
+	Detail  string
+}
+
+// AuditOptions 审计选项
+type AuditOptions struct {
+	FixTTL    bool  // 为缺少 TTL 的 key 设置声明的默认 TTL
+	Undefined bool  // 报告命名空间下未声明的 key
+	MaxIssues int   // 最多报告的问题数，默认 1000
+	BatchSize int64 // 每次 SCAN 的数量，默认 500
+}
+
+/*
+AuditKeys 扫描命名空间下的所有 key，检查：
+
+  - 声明了 TTL 的 key 是否缺少过期时间（忘记 Expire 会导致内存只增不减）
+  - 数据类型是否与声明一致
+  - 是否存在未声明的 key（需开启 Undefined）
+
+使用 SCAN 遍历，不阻塞 Redis，但 key 很多时耗时较长，建议在启动后异步执行
+
+	issues, err := db.AuditKeys(ctx, Keys, db.AuditOptions{FixTTL: true})
+	for _, is := range issues {
+		log.Printf("redis key audit: %s %s %s", is.Problem, is.Key, is.Detail)
+	}
+*/
+func (s *RedisStore) AuditKeys(ctx context.Context, ks *Keyspace, opts AuditOptions) ([]KeyIssue, error) {
+	if opts.MaxIssues <= 0 {
+		opts.MaxIssues = 1000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	var (
+		mu     sync.Mutex
+		issues []KeyIssue
+	)
+	full := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(issues) >= opts.MaxIssues
+	}
+	report := func(is KeyIssue) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(issues) < opts.MaxIssues {
+			issues = append(issues, is)
+		}
+	}
+
+	err := s.forEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		var cursor uint64
+		for !full() {
+			keys, next, err := node.Scan(ctx, cursor, ks.prefix+"*", opts.BatchSize).Result()
+			if err != nil {
+				return err
+			}
+			if err := auditBatch(ctx, node, ks, keys, opts, report); err != nil {
+				return err
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+		return nil
+	})
+	return issues, err
+}
+
+func auditBatch(ctx context.Context, node *redis.Client, ks *Keyspace, keys []string, opts AuditOptions, report func(KeyIssue)) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ttls := make([]*redis.DurationCmd, len(keys))
+	types := make([]*redis.StatusCmd, len(keys))
+	_, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			ttls[i] = pipe.PTTL(ctx, key)
+			types[i] = pipe.Type(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var fix []string
+	var fixTTL []time.Duration
+	for i, key := range keys {
+		typ := types[i].Val()
+		if typ == "none" {
+			// 扫描期间已过期或被删除
+			continue
+		}
+		d := ks.Lookup(key)
+		if d == nil {
+			if opts.Undefined {
+				report(KeyIssue{Key: key, Problem: "undefined", Detail: typ})
+			}
+			continue
+		}
+		if d.Type != "" && KeyType(typ) != d.Type {
+			report(KeyIssue{Key: key, Def: d.Name, Problem: "type mismatch", Detail: fmt.Sprintf("want %s, got %s", d.Type, typ)})
+		}
+		// PTTL 返回 -1 表示没有过期时间
+		if d.TTL > 0 && ttls[i].Val() == -1 {
+			detail := "want " + d.TTL.String()
+			if opts.FixTTL {
+				fix = append(fix, key)
+				fixTTL = append(fixTTL, d.TTL)
+				detail += ", fixed"
+			}
+			report(KeyIssue{Key: key, Def: d.Name, Problem: "no ttl", Detail: detail})
+		}
+	}
+	if len(fix) == 0 {
+		return nil
+	}
+	_, err = node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range fix {
+			pipe.Expire(ctx, key, fixTTL[i])
+		}
+		return nil
+	})
+	return err
+}
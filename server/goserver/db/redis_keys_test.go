@@ -0,0 +1,75 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestKeyspace(t *testing.T) {
+	ks := db.NewKeyspace("prod", "coin")
+	user := ks.Define("cache:user", db.KeyString, time.Hour)
+	ks.Define("cache", db.KeyString, 0)
+
+	equal(t, user.Key(1001), "prod:coin:cache:user:1001")
+	equal(t, user.Pattern(), "prod:coin:cache:user:*")
+	equal(t, ks.Lookup("prod:coin:cache:user:1001"), user)
+	equal(t, ks.Lookup("prod:coin:cache:item:1").Name, "cache")
+	equal(t, ks.Lookup("dev:coin:cache:user:1") == nil, true)
+	equal(t, ks.Subsystem("wallet"), "prod:coin:wallet:")
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("defining a key twice should panic")
+		}
+	}()
+	ks.Define("cache:user", db.KeyString, 0)
+}
+
+func TestAuditKeys(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	ks := db.NewKeyspace("test", "coin")
+	user := ks.Define("cache:user", db.KeyString, time.Hour)
+	bag := ks.Define("bag", db.KeyHash, 0)
+	wallet := s.NewWallet(db.WalletOptions{Prefix: ks.Subsystem("wallet")})
+	repo := db.NewRepository[profile](s, dbtest.NewCollection(), "players", db.RepositoryOptions{Prefix: ks.Subsystem("repo")})
+
+	mr.Set(user.Key(1), "{}")
+	mr.SetTTL(user.Key(1), time.Minute)
+	mr.Set(user.Key(2), "{}") // 缺少 TTL
+	mr.Set(bag.Key(1), "x")   // 类型不符
+	mr.Set("test:coin:misc:1", "x")
+	mr.Set("other:key", "x") // 不在命名空间内
+	_, err := wallet.Grant(ctx, "u1", "gold", 1, "txn-1")
+	must(t, err)
+	rec := db.Record[profile]{ID: "p1"}
+	must(t, repo.Save(ctx, &rec))
+
+	issues, err := s.AuditKeys(ctx, ks, db.AuditOptions{FixTTL: true, Undefined: true})
+	must(t, err)
+	var got []string
+	for _, is := range issues {
+		got = append(got, is.Problem+" "+is.Key)
+	}
+	slices.Sort(got)
+	equal(t, strings.Join(got, ", "), "no ttl test:coin:cache:user:2, type mismatch test:coin:bag:1, undefined test:coin:misc:1")
+	equal(t, mr.TTL(user.Key(2)), time.Hour)
+}
+
+func TestAuditKeysMaxIssues(t *testing.T) {
+	s, mr := dbtest.NewStore(t)
+	ks := db.NewKeyspace("test", "coin")
+	for i := 0; i < 20; i++ {
+		mr.Set(fmt.Sprintf("test:coin:x:%d", i), "v")
+	}
+	issues, err := s.AuditKeys(context.Background(), ks, db.AuditOptions{Undefined: true, MaxIssues: 5, BatchSize: 3})
+	must(t, err)
+	equal(t, len(issues), 5)
+}
@@ -0,0 +1,331 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type ScoreMode int
+
+const (
+	ScoreBest ScoreMode = iota // 只保留最高分
+	ScoreSum                   // 累加分数
+)
+
+type Season int
+
+const (
+	SeasonNone   Season = iota // 不分赛季
+	SeasonDaily                // 日榜，每天 0 点切换
+	SeasonWeekly               // 周榜，每周一 0 点切换
+)
+
+/*
+ZSet 中存储的是组合分数：score * 2^20 + tie，tie 越大表示越早达到该分数，同分时排名更靠前。
+日榜/周榜的 tie 以秒为单位（周榜 604800 秒 < 2^20），总榜以小时为单位（2^20 小时约 119 年），
+所以总榜上同一小时内达到同分的玩家不分先后，按 ZSet 的规则以 member 逆字典序排列。
+组合分数须在 2^53 以内才能精确表示，因此分数范围为 ±MaxLeaderboardScore
+*/
+const (
+	tieBits             = 20
+	tieScale            = 1 << tieBits
+	MaxLeaderboardScore = 1<<(53-tieBits) - 1
+)
+
+// tieEpoch 总榜计算 tie 的起点
+var tieEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// submitScript 原子地按 best/sum 语义更新分数，分数变化时刷新 tie。
+// Lua 数字转字符串默认只保留 14 位有效数字，组合分数需用 %.0f 格式化
+var submitScript = redis.NewScript(`
+local scale = tonumber(ARGV[4])
+local score = tonumber(ARGV[2])
+local old = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if old then
+	local oldScore = math.floor(tonumber(old) / scale)
+	if ARGV[5] == "sum" then
+		score = oldScore + score
+	elseif score <= oldScore then
+		return oldScore
+	end
+end
+if math.abs(score) > tonumber(ARGV[6]) then
+	return redis.error_reply("score out of range")
+end
+redis.call("ZADD", KEYS[1], string.format("%.0f", score * scale + tonumber(ARGV[3])), ARGV[1])
+if tonumber(ARGV[7]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[7])
+end
+return score`)
+
+// LeaderboardOptions 排行榜配置，零值字段使用默认值
+type LeaderboardOptions struct {
+	Prefix       string         // key 前缀，默认 "lb:"
+	Mode         ScoreMode      // 分数语义，默认 ScoreBest
+	Season       Season         // 赛季周期，默认 SeasonNone
+	Location     *time.Location // 赛季切换使用的时区，默认 time.Local
+	SnapshotSize int64          // 赛季结束时归档前 N 名，默认 100
+	ArchiveTTL   time.Duration  // 旧赛季数据与归档的保留时长，默认 30 天
+}
+
+// RankEntry 排行榜条目，Rank 从 1 开始
+type RankEntry struct {
+	Member string `json:"member"`
+	Score  int64  `json:"score"`
+	Rank   int64  `json:"rank"`
+}
+
+// Leaderboard 基于 ZSet 的排行榜，同分按达成时间先后排名（总榜精确到小时），支持日榜/周榜自动切换与归档
+type Leaderboard struct {
+	store *RedisStore
+	name  string
+	opts  LeaderboardOptions
+}
+
+// NewLeaderboard 创建排行榜
+func (s *RedisStore) NewLeaderboard(name string, opts LeaderboardOptions) *Leaderboard {
+	if opts.Prefix == "" {
+		opts.Prefix = "lb:"
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.SnapshotSize <= 0 {
+		opts.SnapshotSize = 100
+	}
+	if opts.ArchiveTTL <= 0 {
+		opts.ArchiveTTL = 30 * 24 * time.Hour
+	}
+	return &Leaderboard{store: s, name: name, opts: opts}
+}
+
+// SeasonID 时间 t 所在赛季的编号：日榜 20060102，周榜 2006W01，总榜 all
+func (lb *Leaderboard) SeasonID(t time.Time) string {
+	t = t.In(lb.opts.Location)
+	switch lb.opts.Season {
+	case SeasonDaily:
+		return t.Format("20060102")
+	case SeasonWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04dW%02d", year, week)
+	default:
+		return "all"
+	}
+}
+
+// seasonStart 时间 t 所在赛季的开始时间
+func (lb *Leaderboard) seasonStart(t time.Time) time.Time {
+	t = t.In(lb.opts.Location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, lb.opts.Location)
+	switch lb.opts.Season {
+	case SeasonDaily:
+		return day
+	case SeasonWeekly:
+		// 周一为一周的第一天
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	default:
+		return tieEpoch
+	}
+}
+
+// seasonEnd 时间 t 所在赛季的结束时间，总榜返回零值
+func (lb *Leaderboard) seasonEnd(t time.Time) time.Time {
+	start := lb.seasonStart(t)
+	switch lb.opts.Season {
+	case SeasonDaily:
+		return start.AddDate(0, 0, 1)
+	case SeasonWeekly:
+		return start.AddDate(0, 0, 7)
+	default:
+		return time.Time{}
+	}
+}
+
+// 使用 hash tag 保证同一排行榜的所有 key 在集群中位于同一 slot
+func (lb *Leaderboard) key(seasonID string) string {
+	return fmt.Sprintf("%s{%s}:%s", lb.opts.Prefix, lb.name, seasonID)
+}
+
+func (lb *Leaderboard) archiveKey(seasonID string) string {
+	return fmt.Sprintf("%s{%s}:archive:%s", lb.opts.Prefix, lb.name, seasonID)
+}
+
+func (lb *Leaderboard) tie(t time.Time) int64 {
+	elapsed := t.Sub(lb.seasonStart(t))
+	var units int64
+	if lb.opts.Season == SeasonNone {
+		units = int64(elapsed / time.Hour)
+	} else {
+		units = int64(elapsed / time.Second)
+	}
+	units = min(max(units, 0), tieScale-1)
+	return tieScale - 1 - units
+}
+
+func decodeScore(composite float64) int64 {
+	return int64(math.Floor(composite / tieScale))
+}
+
+// Submit 提交分数，返回提交后的分数（ScoreBest 下为历史最高分，ScoreSum 下为累计分）
+func (lb *Leaderboard) Submit(ctx context.Context, member string, score int64) (int64, error) {
+	now := time.Now()
+	mode := "best"
+	if lb.opts.Mode == ScoreSum {
+		mode = "sum"
+	}
+	// 赛季榜在赛季结束后继续保留 ArchiveTTL
+	var expire int64
+	if end := lb.seasonEnd(now); !end.IsZero() {
+		expire = (end.Sub(now) + lb.opts.ArchiveTTL).Milliseconds()
+	}
+	return submitScript.Run(ctx, lb.store.rdb, []string{lb.key(lb.SeasonID(now))},
+		member, score, lb.tie(now), tieScale, mode, MaxLeaderboardScore, expire).Int64()
+}
+
+// Score 查询当前赛季分数，未上榜返回 ErrNotFound
+func (lb *Leaderboard) Score(ctx context.Context, member string) (int64, error) {
+	v, err := lb.store.rdb.ZScore(ctx, lb.key(lb.SeasonID(time.Now())), member).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return decodeScore(v), nil
+}
+
+// Rank 查询当前赛季排名，未上榜返回 ErrNotFound
+func (lb *Leaderboard) Rank(ctx context.Context, member string) (RankEntry, error) {
+	key := lb.key(lb.SeasonID(time.Now()))
+	res, err := lb.store.rdb.ZRevRankWithScore(ctx, key, member).Result()
+	if errors.Is(err, redis.Nil) {
+		return RankEntry{}, ErrNotFound
+	}
+	if err != nil {
+		return RankEntry{}, err
+	}
+	return RankEntry{Member: member, Score: decodeScore(res.Score), Rank: res.Rank + 1}, nil
+}
+
+// Around 查询玩家前后各 n 名（含玩家本人），未上榜返回 ErrNotFound
+func (lb *Leaderboard) Around(ctx context.Context, member string, n int64) ([]RankEntry, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("db: leaderboard around n %d must not be negative", n)
+	}
+	key := lb.key(lb.SeasonID(time.Now()))
+	rank, err := lb.store.rdb.ZRevRank(ctx, key, member).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lb.rangeByRank(ctx, key, max(rank-n, 0), rank+n)
+}
+
+// Top 分页查询当前赛季排行，page 从 0 开始，pageSize 须大于 0
+func (lb *Leaderboard) Top(ctx context.Context, page, pageSize int64) ([]RankEntry, error) {
+	if page < 0 || pageSize <= 0 {
+		return nil, fmt.Errorf("db: invalid leaderboard page %d size %d", page, pageSize)
+	}
+	start := page * pageSize
+	return lb.rangeByRank(ctx, lb.key(lb.SeasonID(time.Now())), start, start+pageSize-1)
+}
+
+// Count 当前赛季上榜人数
+func (lb *Leaderboard) Count(ctx context.Context) (int64, error) {
+	return lb.store.rdb.ZCard(ctx, lb.key(lb.SeasonID(time.Now()))).Result()
+}
+
+// Remove 从当前赛季移除玩家
+func (lb *Leaderboard) Remove(ctx context.Context, members ...string) error {
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	return lb.store.rdb.ZRem(ctx, lb.key(lb.SeasonID(time.Now())), args...).Err()
+}
+
+func (lb *Leaderboard) rangeByRank(ctx context.Context, key string, start, stop int64) ([]RankEntry, error) {
+	zs, err := lb.store.rdb.ZRevRangeWithScores(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]RankEntry, len(zs))
+	for i, z := range zs {
+		entries[i] = RankEntry{
+			Member: fmt.Sprint(z.Member),
+			Score:  decodeScore(z.Score),
+			Rank:   start + int64(i) + 1,
+		}
+	}
+	return entries, nil
+}
+
+// Rollover 归档上一个赛季的前 SnapshotSize 名，多个节点同时调用时只有一个会执行。返回是否执行了归档
+func (lb *Leaderboard) Rollover(ctx context.Context) (bool, error) {
+	if lb.opts.Season == SeasonNone {
+		return false, nil
+	}
+	prev := lb.SeasonID(lb.seasonStart(time.Now()).Add(-time.Second))
+	archiveKey := lb.archiveKey(prev)
+
+	// 先占位，避免重复归档
+	ok, err := lb.store.rdb.SetNX(ctx, archiveKey, "[]", lb.opts.ArchiveTTL).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	entries, err := lb.rangeByRank(ctx, lb.key(prev), 0, lb.opts.SnapshotSize-1)
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(entries); err == nil {
+			err = lb.store.rdb.Set(ctx, archiveKey, data, lb.opts.ArchiveTTL).Err()
+		}
+	}
+	if err != nil {
+		// 归档失败时释放占位，等待下次重试
+		lb.store.rdb.Del(ctx, archiveKey)
+		return false, err
+	}
+	return true, nil
+}
+
+// StartRollover 启动后台协程，每隔 interval 检查一次赛季切换并归档，ctx 取消时退出
+func (lb *Leaderboard) StartRollover(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := lb.Rollover(ctx); err != nil {
+				log.Printf("leaderboard %s rollover err: %v", lb.name, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Archive 读取某个赛季的归档，不存在时返回 ErrNotFound
+func (lb *Leaderboard) Archive(ctx context.Context, seasonID string) ([]RankEntry, error) {
+	data, err := lb.store.rdb.Get(ctx, lb.archiveKey(seasonID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []RankEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
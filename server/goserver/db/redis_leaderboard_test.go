@@ -0,0 +1,177 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestLeaderboardSubmit(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		mode   db.ScoreMode
+		scores []int64
+		want   int64
+	}{
+		{"BestKeepsHighest", db.ScoreBest, []int64{10, 30, 20}, 30},
+		{"BestNegative", db.ScoreBest, []int64{-5, -8}, -5},
+		{"SumAccumulates", db.ScoreSum, []int64{10, 30, 20}, 60},
+		{"SumNegative", db.ScoreSum, []int64{10, -15}, -5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := dbtest.NewStore(t)
+			lb := s.NewLeaderboard("lb", db.LeaderboardOptions{Mode: tt.mode})
+			var got int64
+			for _, score := range tt.scores {
+				var err error
+				got, err = lb.Submit(ctx, "p1", score)
+				must(t, err)
+			}
+			equal(t, got, tt.want)
+			score, err := lb.Score(ctx, "p1")
+			must(t, err)
+			equal(t, score, tt.want)
+		})
+	}
+}
+
+func TestLeaderboardOutOfRange(t *testing.T) {
+	s, _ := dbtest.NewStore(t)
+	lb := s.NewLeaderboard("lb", db.LeaderboardOptions{Mode: db.ScoreSum})
+	if _, err := lb.Submit(context.Background(), "p1", db.MaxLeaderboardScore+1); err == nil {
+		t.Fatal("score beyond MaxLeaderboardScore should be rejected")
+	}
+}
+
+func TestLeaderboardQuery(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	lb := s.NewLeaderboard("lb", db.LeaderboardOptions{Season: db.SeasonDaily})
+	for i := 1; i <= 10; i++ {
+		_, err := lb.Submit(ctx, fmt.Sprintf("p%d", i), int64(i*10))
+		must(t, err)
+	}
+
+	tests := []struct {
+		name  string
+		query func() ([]db.RankEntry, error)
+		want  string
+	}{
+		{"TopFirstPage", func() ([]db.RankEntry, error) { return lb.Top(ctx, 0, 3) }, "[{p10 100 1} {p9 90 2} {p8 80 3}]"},
+		{"TopSecondPage", func() ([]db.RankEntry, error) { return lb.Top(ctx, 1, 3) }, "[{p7 70 4} {p6 60 5} {p5 50 6}]"},
+		{"TopPastEnd", func() ([]db.RankEntry, error) { return lb.Top(ctx, 5, 3) }, "[]"},
+		{"Around", func() ([]db.RankEntry, error) { return lb.Around(ctx, "p5", 1) }, "[{p6 60 5} {p5 50 6} {p4 40 7}]"},
+		{"AroundTop", func() ([]db.RankEntry, error) { return lb.Around(ctx, "p10", 1) }, "[{p10 100 1} {p9 90 2}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query()
+			must(t, err)
+			equal(t, fmt.Sprint(got), tt.want)
+		})
+	}
+
+	rank, err := lb.Rank(ctx, "p8")
+	must(t, err)
+	equal(t, rank, db.RankEntry{Member: "p8", Score: 80, Rank: 3})
+
+	n, err := lb.Count(ctx)
+	must(t, err)
+	equal(t, n, int64(10))
+
+	must(t, lb.Remove(ctx, "p8"))
+	for _, err := range []error{
+		func() error { _, err := lb.Rank(ctx, "p8"); return err }(),
+		func() error { _, err := lb.Score(ctx, "p8"); return err }(),
+		func() error { _, err := lb.Around(ctx, "p8", 1); return err }(),
+	} {
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+	}
+}
+
+func TestLeaderboardInvalidArgs(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	lb := s.NewLeaderboard("lb", db.LeaderboardOptions{})
+	_, err := lb.Submit(ctx, "p1", 10)
+	must(t, err)
+
+	tests := []struct {
+		name  string
+		query func() ([]db.RankEntry, error)
+	}{
+		{"TopZeroSize", func() ([]db.RankEntry, error) { return lb.Top(ctx, 0, 0) }},
+		{"TopNegativeSize", func() ([]db.RankEntry, error) { return lb.Top(ctx, 0, -1) }},
+		{"TopNegativePage", func() ([]db.RankEntry, error) { return lb.Top(ctx, -1, 10) }},
+		{"AroundNegative", func() ([]db.RankEntry, error) { return lb.Around(ctx, "p1", -1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.query(); err == nil {
+				t.Fatalf("got %v, want an error", got)
+			}
+		})
+	}
+}
+
+// TestLeaderboardTie 同分时 tie 大的（更早达成）排在前面
+func TestLeaderboardTie(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	lb := s.NewLeaderboard("tie", db.LeaderboardOptions{Season: db.SeasonDaily, Location: time.UTC})
+	key := "lb:{tie}:" + lb.SeasonID(time.Now())
+	_, err := mr.ZAdd(key, float64(100<<20+5), "late")
+	must(t, err)
+	_, err = mr.ZAdd(key, float64(100<<20+9), "early")
+	must(t, err)
+
+	got, err := lb.Top(ctx, 0, 10)
+	must(t, err)
+	equal(t, fmt.Sprint(got), "[{early 100 1} {late 100 2}]")
+}
+
+func TestLeaderboardRollover(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	opts := db.LeaderboardOptions{Season: db.SeasonDaily, Location: time.UTC, SnapshotSize: 2}
+
+	none := s.NewLeaderboard("all", db.LeaderboardOptions{})
+	ok, err := none.Rollover(ctx)
+	must(t, err)
+	equal(t, ok, false)
+
+	lb := s.NewLeaderboard("daily", opts)
+	now := time.Now().UTC()
+	prev := lb.SeasonID(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).Add(-time.Second))
+	if _, err := lb.Archive(ctx, prev); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+
+	// 直接写入上一赛季的数据，组合分数 = score * 2^20 + tie
+	key := fmt.Sprintf("lb:{daily}:%s", prev)
+	for i, member := range []string{"a", "b", "c"} {
+		_, err := mr.ZAdd(key, float64(int64(i+1)*100<<20), member)
+		must(t, err)
+	}
+
+	ok, err = lb.Rollover(ctx)
+	must(t, err)
+	equal(t, ok, true)
+	// 其他节点重复调用不会再次归档
+	ok, err = s.NewLeaderboard("daily", opts).Rollover(ctx)
+	must(t, err)
+	equal(t, ok, false)
+
+	entries, err := lb.Archive(ctx, prev)
+	must(t, err)
+	equal(t, fmt.Sprint(entries), "[{c 300 1} {b 200 2}]")
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrLockNotHeld = errors.New("db: lock not held")
+	ErrLockHeld    = errors.New("db: lock already held by this Lock")
+)
+
+var (
+	// 值与 token 一致才删除，避免误删他人的锁
+	unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	// 值与 token 一致才续期
+	refreshScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// LockOptions 锁配置，零值字段使用默认值
+type LockOptions struct {
+	TTL        time.Duration // 锁过期时间，默认 10s
+	RetryMin   time.Duration // 阻塞获取时的初始重试间隔，默认 50ms
+	RetryMax   time.Duration // 阻塞获取时的最大重试间隔，默认 1s
+	NoWatchdog bool          // 关闭自动续期，任务必须在 TTL 内完成
+}
+
+// Lock 分布式锁，每次加锁生成随机 token，只有持有者能续期和释放。
+// 持有期间看门狗每 TTL/3 续期一次，续期发现锁已不属于自己或连续 TTL 时长续期失败时关闭 Lost() 通道
+type Lock struct {
+	store *RedisStore
+	key   string
+	opts  LockOptions
+
+	mu    sync.Mutex
+	token string
+	stop  chan struct{}
+	lost  chan struct{}
+}
+
+// NewLock 创建分布式锁（不会立即加锁）
+func (s *RedisStore) NewLock(key string, opts LockOptions) *Lock {
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.RetryMin <= 0 {
+		opts.RetryMin = 50 * time.Millisecond
+	}
+	if opts.RetryMax < opts.RetryMin {
+		opts.RetryMax = max(time.Second, opts.RetryMin)
+	}
+	return &Lock{store: s, key: key, opts: opts}
+}
+
+// Key 锁对应的 key
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token 当前持有的 token，未持有时为空
+func (l *Lock) Token() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.token
+}
+
+// Lost 锁被动丢失（过期后被他人获取，或续期失败超过 TTL）时关闭，未持有锁时返回 nil
+func (l *Lock) Lost() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+// TryLock 尝试加锁一次，锁被占用时返回 false
+func (l *Lock) TryLock(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token != "" {
+		return false, ErrLockHeld
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return false, err
+	}
+	// 以发出请求的时间作为锁的起始时间，锁实际的过期时间不会早于 start + TTL
+	start := time.Now()
+	ok, err := l.store.rdb.SetNX(ctx, l.key, token, l.opts.TTL).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	l.token = token
+	l.lost = make(chan struct{})
+	if !l.opts.NoWatchdog {
+		l.stop = make(chan struct{})
+		go l.watchdog(token, start, l.stop, l.lost)
+	}
+	return true, nil
+}
+
+// Lock 阻塞加锁，按指数退避（带抖动）重试，直到成功或 ctx 取消
+func (l *Lock) Lock(ctx context.Context) error {
+	backoff := l.opts.RetryMin
+	for {
+		ok, err := l.TryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		// 抖动避免多个等待者同时重试
+		wait := backoff/2 + mrand.N(backoff/2+1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, l.opts.RetryMax)
+	}
+}
+
+// Refresh 手动续期 TTL，锁已不属于自己时返回 ErrLockNotHeld
+func (l *Lock) Refresh(ctx context.Context) error {
+	l.mu.Lock()
+	token := l.token
+	l.mu.Unlock()
+	if token == "" {
+		return ErrLockNotHeld
+	}
+	ok, err := l.refresh(ctx, token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Unlock 释放锁（校验 token），锁已过期或被他人持有时返回 ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.token == "" {
+		return ErrLockNotHeld
+	}
+	token := l.token
+	l.token = ""
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	l.lost = nil
+
+	n, err := unlockScript.Run(ctx, l.store.rdb, []string{l.key}, token).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+func (l *Lock) refresh(ctx context.Context, token string) (bool, error) {
+	n, err := refreshScript.Run(ctx, l.store.rdb, []string{l.key}, token, l.opts.TTL.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// watchdog 定期续期，renewed 为最近一次续期成功（发出请求）的时间，
+// 续期一直失败且距 renewed 已超过 TTL 时锁可能已被他人获取，视为丢失
+func (l *Lock) watchdog(token string, renewed time.Time, stop, lost chan struct{}) {
+	interval := l.opts.TTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			start := time.Now()
+			ok, err := l.refresh(ctx, token)
+			cancel()
+			if err != nil {
+				log.Printf("lock %s renew err: %v", l.key, err)
+				if time.Since(renewed) >= l.opts.TTL {
+					log.Printf("lock %s not renewed within ttl, treat as lost", l.key)
+					close(lost)
+					return
+				}
+				// 网络抖动时等下一次续期，锁仍在 TTL 内
+				continue
+			}
+			if !ok {
+				log.Printf("lock %s lost", l.key)
+				close(lost)
+				return
+			}
+			renewed = start
+		}
+	}
+}
+
+func newLockToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
@@ -0,0 +1,149 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore)
+	}{
+		{"Contention", func(t *testing.T, s *db.RedisStore) {
+			a := s.NewLock("lock:order", db.LockOptions{NoWatchdog: true})
+			b := s.NewLock("lock:order", db.LockOptions{NoWatchdog: true})
+			ok, err := a.TryLock(ctx)
+			must(t, err)
+			equal(t, ok, true)
+			ok, err = b.TryLock(ctx)
+			must(t, err)
+			equal(t, ok, false)
+			must(t, a.Unlock(ctx))
+			ok, err = b.TryLock(ctx)
+			must(t, err)
+			equal(t, ok, true)
+		}},
+		{"HeldTwice", func(t *testing.T, s *db.RedisStore) {
+			l := s.NewLock("lock:x", db.LockOptions{NoWatchdog: true})
+			_, err := l.TryLock(ctx)
+			must(t, err)
+			if _, err := l.TryLock(ctx); !errors.Is(err, db.ErrLockHeld) {
+				t.Fatalf("err = %v, want ErrLockHeld", err)
+			}
+		}},
+		{"UnlockNotHeld", func(t *testing.T, s *db.RedisStore) {
+			l := s.NewLock("lock:x", db.LockOptions{})
+			if err := l.Unlock(ctx); !errors.Is(err, db.ErrLockNotHeld) {
+				t.Fatalf("err = %v, want ErrLockNotHeld", err)
+			}
+		}},
+		{"UnlockOthers", func(t *testing.T, s *db.RedisStore) {
+			l := s.NewLock("lock:x", db.LockOptions{NoWatchdog: true})
+			_, err := l.TryLock(ctx)
+			must(t, err)
+			// 锁过期后被他人获取，不能误删
+			must(t, s.Set(ctx, "lock:x", "other", 0))
+			if err := l.Unlock(ctx); !errors.Is(err, db.ErrLockNotHeld) {
+				t.Fatalf("err = %v, want ErrLockNotHeld", err)
+			}
+			v, _ := s.Get(ctx, "lock:x")
+			equal(t, v, "other")
+		}},
+		{"RefreshNotHeld", func(t *testing.T, s *db.RedisStore) {
+			l := s.NewLock("lock:x", db.LockOptions{NoWatchdog: true})
+			_, err := l.TryLock(ctx)
+			must(t, err)
+			_, err = s.Del(ctx, "lock:x")
+			must(t, err)
+			if err := l.Refresh(ctx); !errors.Is(err, db.ErrLockNotHeld) {
+				t.Fatalf("err = %v, want ErrLockNotHeld", err)
+			}
+		}},
+		{"LockTimeout", func(t *testing.T, s *db.RedisStore) {
+			must(t, s.Set(ctx, "lock:x", "other", 0))
+			l := s.NewLock("lock:x", db.LockOptions{RetryMin: 10 * time.Millisecond})
+			ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			if err := l.Lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want DeadlineExceeded", err)
+			}
+		}},
+		{"LockWaits", func(t *testing.T, s *db.RedisStore) {
+			a := s.NewLock("lock:x", db.LockOptions{NoWatchdog: true})
+			_, err := a.TryLock(ctx)
+			must(t, err)
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				_ = a.Unlock(ctx)
+			}()
+			b := s.NewLock("lock:x", db.LockOptions{RetryMin: 10 * time.Millisecond, NoWatchdog: true})
+			waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			must(t, b.Lock(waitCtx))
+		}},
+		{"Lost", func(t *testing.T, s *db.RedisStore) {
+			l := s.NewLock("lock:x", db.LockOptions{TTL: 150 * time.Millisecond})
+			_, err := l.TryLock(ctx)
+			must(t, err)
+			lost := l.Lost()
+			_, err = s.Del(ctx, "lock:x")
+			must(t, err)
+			select {
+			case <-lost:
+			case <-time.After(time.Second):
+				t.Fatal("Lost() not closed after the key was deleted")
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := dbtest.NewStore(t)
+			tt.run(t, s)
+		})
+	}
+}
+
+// TestLockWatchdog 看门狗续期使锁在 TTL 之后仍然有效
+func TestLockWatchdog(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	l := s.NewLock("lock:x", db.LockOptions{TTL: 150 * time.Millisecond})
+	_, err := l.TryLock(ctx)
+	must(t, err)
+	defer l.Unlock(ctx)
+
+	// miniredis 的 TTL 只随 FastForward 变化，看门狗续期会把它重置为完整 TTL
+	mr.SetTTL("lock:x", time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if ttl := mr.TTL("lock:x"); ttl != 150*time.Millisecond {
+		t.Fatalf("ttl = %v, want renewed to 150ms", ttl)
+	}
+}
+
+// TestLockWatchdogRenewFailure Redis 不可用时，距上次续期成功超过 TTL 后关闭 Lost()
+func TestLockWatchdogRenewFailure(t *testing.T) {
+	ctx := context.Background()
+	s, mr := dbtest.NewStore(t)
+	l := s.NewLock("lock:x", db.LockOptions{TTL: 150 * time.Millisecond})
+	_, err := l.TryLock(ctx)
+	must(t, err)
+
+	start := time.Now()
+	mr.SetError("LOADING simulated outage")
+	select {
+	case <-l.Lost():
+		if d := time.Since(start); d < 100*time.Millisecond {
+			t.Fatalf("lost after %v, want about one ttl", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Lost() not closed after renew failures")
+	}
+}
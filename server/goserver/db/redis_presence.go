@@ -0,0 +1,225 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PresenceOptions 在线状态配置，零值字段使用默认值
+type PresenceOptions struct {
+	Prefix  string        // key 前缀，默认 "presence:"
+	NodeTTL time.Duration // 节点心跳 key 过期时间，默认 30s，Run 每 NodeTTL/3 续期一次
+	// Users 返回本节点当前在线的玩家。节点曾超过 NodeTTL 未续期时，其他节点会清理它的玩家记录，
+	// Heartbeat 发现心跳 key 已不存在时用它重新登记
+	Users func() []string
+}
+
+/*
+Presence 记录玩家所在的服务器节点（user → node）。
+
+	presence:user:<uid>        玩家所在节点 ID
+	presence:node:<node>       节点心跳，带 TTL，节点宕机后自动过期
+	presence:node:<node>:users 节点上的玩家集合，用于宕机后清理
+	presence:nodes             所有注册过的节点
+
+心跳过期的节点上的玩家视为离线，Lookup 会忽略它们，Run 会定期清理
+*/
+type Presence struct {
+	store  *RedisStore
+	nodeID string
+	opts   PresenceOptions
+}
+
+// NewPresence 创建节点 nodeID 的在线状态注册表，nodeID 在集群内必须唯一
+func (s *RedisStore) NewPresence(nodeID string, opts PresenceOptions) *Presence {
+	if opts.Prefix == "" {
+		opts.Prefix = "presence:"
+	}
+	if opts.NodeTTL <= 0 {
+		opts.NodeTTL = 30 * time.Second
+	}
+	return &Presence{store: s, nodeID: nodeID, opts: opts}
+}
+
+// NodeID 本节点 ID
+func (p *Presence) NodeID() string {
+	return p.nodeID
+}
+
+func (p *Presence) userKey(userID string) string {
+	return p.opts.Prefix + "user:" + userID
+}
+
+func (p *Presence) nodeKey(nodeID string) string {
+	return p.opts.Prefix + "node:" + nodeID
+}
+
+func (p *Presence) nodeUsersKey(nodeID string) string {
+	return p.opts.Prefix + "node:" + nodeID + ":users"
+}
+
+func (p *Presence) nodesKey() string {
+	return p.opts.Prefix + "nodes"
+}
+
+// claimScript 玩家记录不存在或已指向本节点时写入，不抢占已在其他节点上线的玩家
+var claimScript = redis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur and cur ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1])
+return 1`)
+
+// Online 标记玩家在本节点上线，玩家在其他节点的旧记录会被覆盖。
+// 两条命令在 MULTI 中执行；集群模式下两个 key 不在同一 slot，go-redis 按 slot 拆分事务，
+// 先写节点玩家集合，失败时最多留下一个多余的集合成员，清理时会被忽略
+func (p *Presence) Online(ctx context.Context, userID string) error {
+	_, err := p.store.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, p.nodeUsersKey(p.nodeID), userID)
+		pipe.Set(ctx, p.userKey(userID), p.nodeID, 0)
+		return nil
+	})
+	return err
+}
+
+// Offline 标记玩家从本节点下线，玩家已在其他节点重新上线时不会删除其记录
+func (p *Presence) Offline(ctx context.Context, userID string) error {
+	if err := unlockScript.Run(ctx, p.store.rdb, []string{p.userKey(userID)}, p.nodeID).Err(); err != nil {
+		return err
+	}
+	return p.store.rdb.SRem(ctx, p.nodeUsersKey(p.nodeID), userID).Err()
+}
+
+// Lookup 查询玩家所在节点，玩家不在线或所在节点心跳已过期时返回 ErrNotFound
+func (p *Presence) Lookup(ctx context.Context, userID string) (string, error) {
+	nodeID, err := p.store.rdb.Get(ctx, p.userKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if nodeID == p.nodeID {
+		return nodeID, nil
+	}
+	alive, err := p.store.rdb.Exists(ctx, p.nodeKey(nodeID)).Result()
+	if err != nil {
+		return "", err
+	}
+	if alive == 0 {
+		return "", ErrNotFound
+	}
+	return nodeID, nil
+}
+
+// Heartbeat 续期本节点心跳。心跳 key 已不存在（首次启动或曾超过 NodeTTL 未续期）时，
+// 按 PresenceOptions.Users 重新登记本节点的玩家
+func (p *Presence) Heartbeat(ctx context.Context) error {
+	err := p.store.rdb.SetArgs(ctx, p.nodeKey(p.nodeID), time.Now().Unix(), redis.SetArgs{TTL: p.opts.NodeTTL, Get: true}).Err()
+	lost := errors.Is(err, redis.Nil)
+	if err != nil && !lost {
+		return err
+	}
+	if err := p.store.rdb.SAdd(ctx, p.nodesKey(), p.nodeID).Err(); err != nil {
+		return err
+	}
+	if !lost || p.opts.Users == nil {
+		return nil
+	}
+	if err := p.register(ctx, p.opts.Users()); err != nil {
+		// 删除心跳 key，下次心跳重试登记
+		p.store.rdb.Del(ctx, p.nodeKey(p.nodeID))
+		return err
+	}
+	return nil
+}
+
+// register 重新登记本节点的玩家，期间已在其他节点上线的玩家保持不变
+func (p *Presence) register(ctx context.Context, users []string) error {
+	if len(users) == 0 {
+		return nil
+	}
+	_, err := p.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, userID := range users {
+			pipe.SAdd(ctx, p.nodeUsersKey(p.nodeID), userID)
+			claimScript.Eval(ctx, pipe, []string{p.userKey(userID)}, p.nodeID)
+		}
+		return nil
+	})
+	return err
+}
+
+// Run 每 NodeTTL/3 续期心跳并清理已宕机节点的玩家记录，阻塞直到 ctx 取消
+func (p *Presence) Run(ctx context.Context) error {
+	interval := p.opts.NodeTTL / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Heartbeat(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("presence %s heartbeat err: %v", p.nodeID, err)
+		}
+		if err := p.sweep(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("presence %s sweep err: %v", p.nodeID, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Leave 节点正常关闭时调用，清除本节点心跳与所有玩家记录
+func (p *Presence) Leave(ctx context.Context) error {
+	if err := p.store.rdb.Del(ctx, p.nodeKey(p.nodeID)).Err(); err != nil {
+		return err
+	}
+	return p.cleanNode(ctx, p.nodeID)
+}
+
+// sweep 清理心跳已过期的节点，多个节点同时清理是安全的
+func (p *Presence) sweep(ctx context.Context) error {
+	nodes, err := p.store.rdb.SMembers(ctx, p.nodesKey()).Result()
+	if err != nil {
+		return err
+	}
+	for _, nodeID := range nodes {
+		if nodeID == p.nodeID {
+			continue
+		}
+		alive, err := p.store.rdb.Exists(ctx, p.nodeKey(nodeID)).Result()
+		if err != nil {
+			return err
+		}
+		if alive > 0 {
+			continue
+		}
+		log.Printf("presence node %s dead, cleaning up", nodeID)
+		if err := p.cleanNode(ctx, nodeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Presence) cleanNode(ctx context.Context, nodeID string) error {
+	users, err := p.store.rdb.SMembers(ctx, p.nodeUsersKey(nodeID)).Result()
+	if err != nil {
+		return err
+	}
+	for _, userID := range users {
+		// 只删除仍指向该节点的记录，玩家可能已在其他节点重新上线
+		if err := unlockScript.Run(ctx, p.store.rdb, []string{p.userKey(userID)}, nodeID).Err(); err != nil {
+			return err
+		}
+	}
+	if err := p.store.rdb.Del(ctx, p.nodeUsersKey(nodeID)).Err(); err != nil {
+		return err
+	}
+	return p.store.rdb.SRem(ctx, p.nodesKey(), nodeID).Err()
+}
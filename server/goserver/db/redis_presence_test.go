@@ -0,0 +1,132 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func lookup(t *testing.T, p *db.Presence, userID, want string) {
+	t.Helper()
+	got, err := p.Lookup(context.Background(), userID)
+	if want == "" {
+		if !errors.Is(err, db.ErrNotFound) {
+			t.Fatalf("Lookup(%s) = %q, %v, want ErrNotFound", userID, got, err)
+		}
+		return
+	}
+	must(t, err)
+	equal(t, got, want)
+}
+
+func TestPresence(t *testing.T) {
+	ctx := context.Background()
+	opts := db.PresenceOptions{NodeTTL: 10 * time.Second}
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"Lookup", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			a := s.NewPresence("a", opts)
+			b := s.NewPresence("b", opts)
+			must(t, a.Online(ctx, "u1"))
+			lookup(t, a, "u1", "a")
+			// a 还没有心跳，其他节点视为离线
+			lookup(t, b, "u1", "")
+			must(t, a.Heartbeat(ctx))
+			lookup(t, b, "u1", "a")
+			lookup(t, b, "u2", "")
+			ok, err := mr.SIsMember("presence:node:a:users", "u1")
+			must(t, err)
+			equal(t, ok, true)
+		}},
+		// 玩家转到其他节点后，旧节点的 Offline 不会删除新记录
+		{"Moved", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			a := s.NewPresence("a", opts)
+			b := s.NewPresence("b", opts)
+			must(t, a.Heartbeat(ctx))
+			must(t, b.Heartbeat(ctx))
+			must(t, a.Online(ctx, "u1"))
+			must(t, b.Online(ctx, "u1"))
+			must(t, a.Offline(ctx, "u1"))
+			lookup(t, a, "u1", "b")
+			must(t, b.Offline(ctx, "u1"))
+			lookup(t, a, "u1", "")
+		}},
+		// 心跳过期的节点被清理，已转到其他节点的玩家保留
+		{"Sweep", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			a := s.NewPresence("a", opts)
+			b := s.NewPresence("b", opts)
+			must(t, a.Heartbeat(ctx))
+			must(t, a.Online(ctx, "u1"))
+			must(t, a.Online(ctx, "u2"))
+			must(t, b.Online(ctx, "u2"))
+
+			must(t, b.Sweep(ctx))
+			equal(t, mr.Exists("presence:user:u1"), true)
+
+			mr.FastForward(11 * time.Second)
+			must(t, b.Heartbeat(ctx))
+			must(t, b.Sweep(ctx))
+			equal(t, mr.Exists("presence:user:u1"), false)
+			lookup(t, b, "u2", "b")
+			equal(t, mr.Exists("presence:node:a:users"), false)
+			ok, err := mr.SIsMember("presence:nodes", "a")
+			must(t, err)
+			equal(t, ok, false)
+		}},
+		// 心跳中断被清理的节点恢复后，Heartbeat 重新登记仍在本节点的玩家，不抢占已转走的玩家
+		{"Reregister", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			local := []string{"u1", "u2"}
+			a := s.NewPresence("a", db.PresenceOptions{NodeTTL: opts.NodeTTL, Users: func() []string { return local }})
+			b := s.NewPresence("b", opts)
+			must(t, a.Heartbeat(ctx))
+			must(t, a.Online(ctx, "u1"))
+			must(t, a.Online(ctx, "u2"))
+
+			mr.FastForward(11 * time.Second)
+			must(t, b.Heartbeat(ctx))
+			must(t, b.Sweep(ctx))
+			must(t, b.Online(ctx, "u2"))
+			lookup(t, b, "u1", "")
+
+			must(t, a.Heartbeat(ctx))
+			lookup(t, b, "u1", "a")
+			lookup(t, a, "u2", "b")
+			ok, err := mr.SIsMember("presence:nodes", "a")
+			must(t, err)
+			equal(t, ok, true)
+
+			// 心跳正常续期时不再登记
+			must(t, s.Set(ctx, "presence:user:u1", "c", 0))
+			must(t, a.Heartbeat(ctx))
+			v, _ := mr.Get("presence:user:u1")
+			equal(t, v, "c")
+		}},
+		{"Leave", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			a := s.NewPresence("a", opts)
+			b := s.NewPresence("b", opts)
+			must(t, a.Heartbeat(ctx))
+			must(t, b.Heartbeat(ctx))
+			must(t, a.Online(ctx, "u1"))
+
+			must(t, a.Leave(ctx))
+			lookup(t, b, "u1", "")
+			equal(t, mr.Exists("presence:node:a"), false)
+			equal(t, mr.Exists("presence:user:u1"), false)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
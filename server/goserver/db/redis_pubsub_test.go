@@ -0,0 +1,150 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	ps := s.Subscribe(ctx, "chat")
+	defer ps.Close()
+	_, err := ps.Receive(ctx)
+	must(t, err)
+
+	must(t, s.Publish(ctx, "chat", "hello"))
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	msg, err := ps.ReceiveMessage(ctx)
+	must(t, err)
+	equal(t, msg.Channel, "chat")
+	equal(t, msg.Payload, "hello")
+}
+
+type loginEvent struct {
+	UID int64 `json:"uid"`
+}
+
+func TestEventBus(t *testing.T) {
+	tests := []struct {
+		name string
+		opts db.EventBusOptions
+	}{
+		{"PubSub", db.EventBusOptions{}},
+		{"Stream", db.EventBusOptions{Stream: true, Group: "game", Block: 50 * time.Millisecond}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := dbtest.NewStore(t)
+			bus := s.NewEventBus(tt.opts)
+			got := make(chan loginEvent, 1)
+			db.On(bus, "player.login", func(ctx context.Context, ev loginEvent) error {
+				got <- ev
+				return nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- bus.Run(ctx) }()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			// Pub/Sub 在订阅建立之前发布的事件会丢失，重复发布直到收到
+			deadline := time.After(2 * time.Second)
+			for {
+				must(t, bus.Publish(ctx, "player.login", loginEvent{UID: 42}))
+				select {
+				case ev := <-got:
+					equal(t, ev.UID, int64(42))
+					return
+				case <-time.After(50 * time.Millisecond):
+				case <-deadline:
+					t.Fatal("event not delivered")
+				}
+			}
+		})
+	}
+}
+
+func TestEventBusNoHandlers(t *testing.T) {
+	s, _ := dbtest.NewStore(t)
+	if err := s.NewEventBus(db.EventBusOptions{}).Run(context.Background()); err == nil {
+		t.Fatal("Run without handlers should fail")
+	}
+}
+
+// TestEventBusRedeliver Stream 模式下处理失败的事件不 ACK，在 ClaimIdle 之后重新投递
+func TestEventBusRedeliver(t *testing.T) {
+	tests := []struct {
+		name string
+		// extra 注册在重试处理函数之前的其他处理函数
+		extra func(bus *db.EventBus)
+	}{
+		{"HandlerError", func(bus *db.EventBus) {}},
+		// 只有部分处理函数解析失败时同样不 ACK
+		{"PartialDecodeError", func(bus *db.EventBus) {
+			// uid 为数字，解析为字符串失败
+			db.On(bus, "order.paid", func(ctx context.Context, ev struct {
+				UID string `json:"uid"`
+			}) error {
+				return nil
+			})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := dbtest.NewStore(t)
+			bus := s.NewEventBus(db.EventBusOptions{
+				Stream:    true,
+				Group:     "game",
+				Block:     20 * time.Millisecond,
+				ClaimIdle: 100 * time.Millisecond,
+			})
+			tt.extra(bus)
+			var calls atomic.Int32
+			done := make(chan struct{})
+			db.On(bus, "order.paid", func(ctx context.Context, ev loginEvent) error {
+				if calls.Add(1) == 1 {
+					return errors.New("temporary failure")
+				}
+				close(done)
+				return nil
+			})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan error, 1)
+			go func() { stopped <- bus.Run(ctx) }()
+			defer func() {
+				cancel()
+				<-stopped
+			}()
+
+			// 等待消费组创建，之前发布的事件不会被投递
+			time.Sleep(50 * time.Millisecond)
+			must(t, bus.Publish(ctx, "order.paid", loginEvent{UID: 1}))
+			select {
+			case <-done:
+			case <-time.After(2 * time.Second):
+				t.Fatalf("event not redelivered, calls = %d", calls.Load())
+			}
+		})
+	}
+}
+
+// TestEventBusStreamKeys Stream 模式的 key 带相同 hash tag，集群模式下可一次读取多个主题
+func TestEventBusStreamKeys(t *testing.T) {
+	s, mr := dbtest.NewStore(t)
+	bus := s.NewEventBus(db.EventBusOptions{Stream: true, Group: "game"})
+	must(t, bus.Publish(context.Background(), "player.login", loginEvent{UID: 1}))
+	must(t, bus.Publish(context.Background(), "order.paid", loginEvent{UID: 1}))
+	equal(t, fmt.Sprint(mr.Keys()), "[event:{bus}:order.paid event:{bus}:player.login]")
+}
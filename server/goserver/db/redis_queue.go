@@ -0,0 +1,486 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrQueueEmpty = errors.New("db: queue empty")
+	ErrJobExists  = errors.New("db: job already exists")
+)
+
+var (
+	// 写入任务数据，到期的进入 ready，未到期的进入 delayed。相同 ID 的任务已存在时返回 0
+	enqueueScript = redis.NewScript(`
+if redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+if tonumber(ARGV[3]) <= tonumber(ARGV[4]) then
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+else
+	redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+end
+return 1`)
+
+	// 把到期的延时任务移入 ready
+	promoteScript = redis.NewScript(`
+local ids = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call("ZREM", KEYS[1], id)
+	redis.call("LPUSH", KEYS[2], id)
+end
+return #ids`)
+
+	// 任务完成，清除所有记录
+	ackScript = redis.NewScript(`
+redis.call("LREM", KEYS[1], 1, ARGV[1])
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[3], ARGV[1])
+redis.call("HDEL", KEYS[4], ARGV[1])
+redis.call("HDEL", KEYS[5], ARGV[1])
+return 1`)
+
+	/*
+		任务失败或可见性超时：重试次数 +1，未超过上限时按指数退避放入 delayed，否则放入死信队列。
+		任务已不在处理中（已 ACK 或已被超时回收）时返回 -1，重试时返回 0，进入死信时返回 1
+	*/
+	failScript = redis.NewScript(`
+local removed = redis.call("LREM", KEYS[1], 1, ARGV[1])
+if redis.call("ZREM", KEYS[2], ARGV[1]) == 0 and removed == 0 then
+	return -1
+end
+redis.call("HSET", KEYS[4], ARGV[1], ARGV[6])
+local n = redis.call("HINCRBY", KEYS[3], ARGV[1], 1)
+if n > tonumber(ARGV[2]) then
+	redis.call("LPUSH", KEYS[6], ARGV[1])
+	return 1
+end
+local delay = math.min(tonumber(ARGV[4]) * math.pow(2, n - 1), tonumber(ARGV[5]))
+redis.call("ZADD", KEYS[5], tonumber(ARGV[3]) + delay, ARGV[1])
+return 0`)
+
+	// 处理中但没有可见性截止时间的任务（BLMOVE 后消费者宕机）补上截止时间
+	recoverScript = redis.NewScript(`
+local ids = redis.call("LRANGE", KEYS[1], 0, -1)
+local n = 0
+for _, id in ipairs(ids) do
+	if not redis.call("ZSCORE", KEYS[2], id) then
+		redis.call("ZADD", KEYS[2], ARGV[1], id)
+		n = n + 1
+	end
+end
+return n`)
+
+	// 死信任务重新入队
+	retryDeadScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[2], ARGV[1])
+redis.call("LPUSH", KEYS[3], ARGV[1])
+return 1`)
+
+	// 取消尚未开始处理的任务
+	cancelScript = redis.NewScript(`
+local n = redis.call("ZREM", KEYS[1], ARGV[1]) + redis.call("LREM", KEYS[2], 0, ARGV[1])
+if n == 0 then
+	return 0
+end
+redis.call("HDEL", KEYS[3], ARGV[1])
+redis.call("HDEL", KEYS[4], ARGV[1])
+redis.call("HDEL", KEYS[5], ARGV[1])
+return 1`)
+)
+
+// QueueOptions 任务队列配置，零值字段使用默认值
+type QueueOptions struct {
+	Prefix      string        // key 前缀，默认 "queue:"
+	Visibility  time.Duration // 任务被取出后须在该时长内 Ack，否则视为失败重新投递，默认 30s
+	MaxRetries  int           // 最大重试次数，超过后进入死信队列，默认 5
+	BackoffMin  time.Duration // 第一次重试的延迟，之后每次翻倍，默认 1s
+	BackoffMax  time.Duration // 重试延迟上限，默认 5min
+	Block       time.Duration // Dequeue 阻塞等待时长，默认 5s，最小 1s（Redis 阻塞命令的超时精度）
+	Poll        time.Duration // Run 中搬运到期延时任务、回收超时任务的间隔，默认 1s
+	Concurrency int           // Run 的并发消费协程数，默认 1
+}
+
+// Job 队列中的任务
+type Job struct {
+	ID         string          `json:"id"`
+	Payload    json.RawMessage `json:"payload"`
+	EnqueuedAt int64           `json:"enqueued_at"` // 毫秒时间戳
+	Attempts   int             `json:"-"`           // 已失败次数
+	LastError  string          `json:"-"`           // 上次失败原因
+}
+
+// Decode 将任务数据反序列化到 v
+func (j *Job) Decode(v any) error {
+	return json.Unmarshal(j.Payload, v)
+}
+
+/*
+Queue 基于 Redis 的可靠任务队列，支持延时任务、失败重试与死信，多个节点可同时消费。
+
+	queue:{name}:ready       List，待处理任务 ID
+	queue:{name}:processing  List，处理中的任务 ID（BLMOVE 原子转移）
+	queue:{name}:inflight    ZSet，处理中任务的可见性截止时间
+	queue:{name}:delayed     ZSet，延时/等待重试的任务，score 为到期时间（毫秒）
+	queue:{name}:dead        List，重试次数用尽的任务 ID
+	queue:{name}:jobs        Hash，任务 ID -> 任务数据
+	queue:{name}:attempts    Hash，任务 ID -> 失败次数
+	queue:{name}:errors      Hash，任务 ID -> 上次失败原因
+
+任务至少投递一次，处理函数需要幂等
+*/
+type Queue struct {
+	store *RedisStore
+	name  string
+	opts  QueueOptions
+}
+
+// NewQueue 创建任务队列
+func (s *RedisStore) NewQueue(name string, opts QueueOptions) *Queue {
+	if opts.Prefix == "" {
+		opts.Prefix = "queue:"
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = 30 * time.Second
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.BackoffMin <= 0 {
+		opts.BackoffMin = time.Second
+	}
+	if opts.BackoffMax < opts.BackoffMin {
+		opts.BackoffMax = max(5*time.Minute, opts.BackoffMin)
+	}
+	if opts.Block <= 0 {
+		opts.Block = 5 * time.Second
+	}
+	opts.Block = max(opts.Block, time.Second)
+	if opts.Poll <= 0 {
+		opts.Poll = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return &Queue{store: s, name: name, opts: opts}
+}
+
+// 使用 hash tag 保证同一队列的所有 key 在集群中位于同一 slot
+func (q *Queue) key(kind string) string {
+	return fmt.Sprintf("%s{%s}:%s", q.opts.Prefix, q.name, kind)
+}
+
+// Enqueue 投递任务，delay 大于 0 时延迟执行，返回任务 ID
+func (q *Queue) Enqueue(ctx context.Context, payload any, delay time.Duration) (string, error) {
+	return q.EnqueueAt(ctx, "", payload, time.Now().Add(delay))
+}
+
+// EnqueueAt 投递在 at 时刻执行的任务。id 为空时自动生成；相同 id 的任务尚未完成时返回 ErrJobExists，
+// 可用于去重，如 "mail-expire:<mailID>"
+func (q *Queue) EnqueueAt(ctx context.Context, id string, payload any, at time.Time) (string, error) {
+	if id == "" {
+		var err error
+		if id, err = newLockToken(); err != nil {
+			return "", err
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	job, err := json.Marshal(Job{ID: id, Payload: data, EnqueuedAt: now.UnixMilli()})
+	if err != nil {
+		return "", err
+	}
+	ok, err := enqueueScript.Run(ctx, q.store.rdb,
+		[]string{q.key("jobs"), q.key("ready"), q.key("delayed")},
+		id, job, at.UnixMilli(), now.UnixMilli()).Bool()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return id, ErrJobExists
+	}
+	return id, nil
+}
+
+// Cancel 取消尚未开始处理的任务，任务不存在或已在处理中时返回 ErrNotFound
+func (q *Queue) Cancel(ctx context.Context, id string) error {
+	ok, err := cancelScript.Run(ctx, q.store.rdb,
+		[]string{q.key("delayed"), q.key("ready"), q.key("jobs"), q.key("attempts"), q.key("errors")}, id).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Dequeue 阻塞取出一个任务（最多 Block），没有任务时返回 ErrQueueEmpty。
+// 取出后须在 Visibility 内调用 Ack 或 Nack，否则任务会被重新投递
+func (q *Queue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		id, err := q.store.rdb.BLMove(ctx, q.key("ready"), q.key("processing"), "RIGHT", "LEFT", q.opts.Block).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrQueueEmpty
+		}
+		if err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(q.opts.Visibility).UnixMilli()
+		if err := q.store.rdb.ZAdd(ctx, q.key("inflight"), redis.Z{Score: float64(deadline), Member: id}).Err(); err != nil {
+			// 留在 processing 中，由 recover 补上截止时间
+			return nil, err
+		}
+
+		var data, attempts, lastErr *redis.StringCmd
+		_, err = q.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			data = pipe.HGet(ctx, q.key("jobs"), id)
+			attempts = pipe.HGet(ctx, q.key("attempts"), id)
+			lastErr = pipe.HGet(ctx, q.key("errors"), id)
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return nil, err
+		}
+		job := &Job{ID: id}
+		if data.Err() != nil {
+			// 任务数据已被删除，丢弃
+			q.Ack(ctx, job)
+			continue
+		}
+		if err := json.Unmarshal([]byte(data.Val()), job); err != nil {
+			q.Ack(ctx, job)
+			log.Printf("queue %s job %s dropped: %v", q.name, id, err)
+			continue
+		}
+		job.Attempts, _ = strconv.Atoi(attempts.Val())
+		job.LastError = lastErr.Val()
+		return job, nil
+	}
+}
+
+// Ack 任务处理成功
+func (q *Queue) Ack(ctx context.Context, job *Job) error {
+	return ackScript.Run(ctx, q.store.rdb,
+		[]string{q.key("processing"), q.key("inflight"), q.key("jobs"), q.key("attempts"), q.key("errors")}, job.ID).Err()
+}
+
+// Nack 任务处理失败，按指数退避重试，重试次数用尽后进入死信队列
+func (q *Queue) Nack(ctx context.Context, job *Job, reason error) error {
+	msg := ""
+	if reason != nil {
+		msg = reason.Error()
+	}
+	_, err := q.fail(ctx, job.ID, msg)
+	return err
+}
+
+// Extend 延长任务的可见性截止时间，用于耗时较长的任务
+func (q *Queue) Extend(ctx context.Context, job *Job, d time.Duration) error {
+	deadline := time.Now().Add(d).UnixMilli()
+	return q.store.rdb.ZAddXX(ctx, q.key("inflight"), redis.Z{Score: float64(deadline), Member: job.ID}).Err()
+}
+
+func (q *Queue) fail(ctx context.Context, id, reason string) (int, error) {
+	return failScript.Run(ctx, q.store.rdb,
+		[]string{q.key("processing"), q.key("inflight"), q.key("attempts"), q.key("errors"), q.key("delayed"), q.key("dead")},
+		id, q.opts.MaxRetries, time.Now().UnixMilli(),
+		q.opts.BackoffMin.Milliseconds(), q.opts.BackoffMax.Milliseconds(), reason).Int()
+}
+
+// Maintain 搬运到期的延时任务并回收可见性超时的任务，Run 会定期调用
+func (q *Queue) Maintain(ctx context.Context) error {
+	now := time.Now()
+	for {
+		n, err := promoteScript.Run(ctx, q.store.rdb, []string{q.key("delayed"), q.key("ready")}, now.UnixMilli(), 100).Int()
+		if err != nil {
+			return err
+		}
+		if n < 100 {
+			break
+		}
+	}
+
+	deadline := now.Add(q.opts.Visibility).UnixMilli()
+	if err := recoverScript.Run(ctx, q.store.rdb, []string{q.key("processing"), q.key("inflight")}, deadline).Err(); err != nil {
+		return err
+	}
+	expired, err := q.store.rdb.ZRangeByScore(ctx, q.key("inflight"), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: 100,
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, id := range expired {
+		if _, err := q.fail(ctx, id, "visibility timeout"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+Run 启动 Concurrency 个消费协程处理任务，阻塞直到 ctx 取消，返回前等待处理中的任务结束（空闲的消费协程最多 Block 后退出）。
+handler 返回 nil 时 Ack，返回错误时 Nack；handler 的 ctx 在 Visibility 后超时
+
+	q := db.NewQueue("energy", db.QueueOptions{})
+	_, _ = q.Enqueue(ctx, EnergyRefill{UID: 1}, 5*time.Minute)
+	go q.Run(ctx, func(ctx context.Context, job *db.Job) error {
+		var ev EnergyRefill
+		if err := job.Decode(&ev); err != nil {
+			return err
+		}
+		return refill(ctx, ev.UID)
+	})
+*/
+func (q *Queue) Run(ctx context.Context, handler func(ctx context.Context, job *Job) error) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(q.opts.Poll)
+		defer ticker.Stop()
+		for {
+			if err := q.Maintain(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("queue %s maintain err: %v", q.name, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	for i := 0; i < q.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// queueFinishTimeout Run 中 Ack/Nack 的超时时间
+const queueFinishTimeout = 5 * time.Second
+
+func (q *Queue) work(ctx context.Context, handler func(ctx context.Context, job *Job) error) {
+	for ctx.Err() == nil {
+		job, err := q.Dequeue(ctx)
+		if errors.Is(err, ErrQueueEmpty) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("queue %s dequeue err: %v", q.name, err)
+				time.Sleep(q.opts.Poll)
+			}
+			continue
+		}
+
+		// 任务处理不随 ctx 取消中断，结果仍需写回
+		jobCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), q.opts.Visibility)
+		err = q.handle(jobCtx, job, handler)
+		cancel()
+		// handler 可能用完了 jobCtx，写回结果使用新的 ctx
+		finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), queueFinishTimeout)
+		if err != nil {
+			err = q.Nack(finishCtx, job, err)
+		} else {
+			err = q.Ack(finishCtx, job)
+		}
+		cancel()
+		if err != nil {
+			log.Printf("queue %s job %s finish err: %v", q.name, job.ID, err)
+		}
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, job *Job, handler func(ctx context.Context, job *Job) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// Len 各状态的任务数
+func (q *Queue) Len(ctx context.Context) (ready, delayed, processing, dead int64, err error) {
+	var cmds [4]*redis.IntCmd
+	_, err = q.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		cmds[0] = pipe.LLen(ctx, q.key("ready"))
+		cmds[1] = pipe.ZCard(ctx, q.key("delayed"))
+		cmds[2] = pipe.LLen(ctx, q.key("processing"))
+		cmds[3] = pipe.LLen(ctx, q.key("dead"))
+		return nil
+	})
+	return cmds[0].Val(), cmds[1].Val(), cmds[2].Val(), cmds[3].Val(), err
+}
+
+// DeadJobs 查看死信队列中最近的 n 个任务
+func (q *Queue) DeadJobs(ctx context.Context, n int64) ([]*Job, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	ids, err := q.store.rdb.LRange(ctx, q.key("dead"), 0, n-1).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var data, attempts, errs *redis.SliceCmd
+	_, err = q.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		data = pipe.HMGet(ctx, q.key("jobs"), ids...)
+		attempts = pipe.HMGet(ctx, q.key("attempts"), ids...)
+		errs = pipe.HMGet(ctx, q.key("errors"), ids...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(ids))
+	for i, id := range ids {
+		job := &Job{ID: id}
+		if s, ok := data.Val()[i].(string); ok {
+			if err := json.Unmarshal([]byte(s), job); err != nil {
+				return nil, err
+			}
+		}
+		if s, ok := attempts.Val()[i].(string); ok {
+			job.Attempts, _ = strconv.Atoi(s)
+		}
+		job.LastError, _ = errs.Val()[i].(string)
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// RetryDead 将死信任务重新放回队列并清零重试次数，任务不在死信队列时返回 ErrNotFound
+func (q *Queue) RetryDead(ctx context.Context, id string) error {
+	ok, err := retryDeadScript.Run(ctx, q.store.rdb, []string{q.key("dead"), q.key("attempts"), q.key("ready")}, id).Bool()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
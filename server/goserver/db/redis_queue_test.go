@@ -0,0 +1,279 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+type refill struct {
+	UID int64 `json:"uid"`
+}
+
+// queueLen 按 ready, delayed, processing, dead 顺序比较各状态的任务数
+func queueLen(t *testing.T, q *db.Queue, ready, delayed, processing, dead int64) {
+	t.Helper()
+	r, d, p, x, err := q.Len(context.Background())
+	must(t, err)
+	if r != ready || d != delayed || p != processing || x != dead {
+		t.Fatalf("len = %d/%d/%d/%d, want %d/%d/%d/%d", r, d, p, x, ready, delayed, processing, dead)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"Ack", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{Block: time.Second})
+
+			id, err := q.Enqueue(ctx, refill{UID: 7}, 0)
+			must(t, err)
+			queueLen(t, q, 1, 0, 0, 0)
+
+			job, err := q.Dequeue(ctx)
+			must(t, err)
+			equal(t, job.ID, id)
+			var ev refill
+			must(t, job.Decode(&ev))
+			equal(t, ev.UID, int64(7))
+			queueLen(t, q, 0, 0, 1, 0)
+
+			must(t, q.Ack(ctx, job))
+			queueLen(t, q, 0, 0, 0, 0)
+			equal(t, mr.Exists("queue:{energy}:jobs"), false)
+			if _, err := q.Dequeue(ctx); !errors.Is(err, db.ErrQueueEmpty) {
+				t.Fatalf("err = %v, want ErrQueueEmpty", err)
+			}
+		}},
+		{"DuplicateID", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("mail", db.QueueOptions{})
+
+			_, err := q.EnqueueAt(ctx, "mail-expire:1", refill{}, time.Now().Add(time.Hour))
+			must(t, err)
+			if _, err := q.EnqueueAt(ctx, "mail-expire:1", refill{}, time.Now()); !errors.Is(err, db.ErrJobExists) {
+				t.Fatalf("err = %v, want ErrJobExists", err)
+			}
+			queueLen(t, q, 0, 1, 0, 0)
+		}},
+		{"Delayed", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{Block: time.Second})
+
+			_, err := q.Enqueue(ctx, refill{UID: 1}, 50*time.Millisecond)
+			must(t, err)
+			must(t, q.Maintain(ctx))
+			queueLen(t, q, 0, 1, 0, 0)
+			if _, err := q.Dequeue(ctx); !errors.Is(err, db.ErrQueueEmpty) {
+				t.Fatalf("err = %v, want ErrQueueEmpty before due", err)
+			}
+
+			time.Sleep(60 * time.Millisecond)
+			must(t, q.Maintain(ctx))
+			queueLen(t, q, 1, 0, 0, 0)
+		}},
+		{"Cancel", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{})
+
+			delayed, err := q.Enqueue(ctx, refill{}, time.Hour)
+			must(t, err)
+			must(t, q.Cancel(ctx, delayed))
+			if err := q.Cancel(ctx, delayed); !errors.Is(err, db.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+
+			// 已在处理中的任务不能取消
+			_, err = q.Enqueue(ctx, refill{}, 0)
+			must(t, err)
+			job, err := q.Dequeue(ctx)
+			must(t, err)
+			if err := q.Cancel(ctx, job.ID); !errors.Is(err, db.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+			queueLen(t, q, 0, 0, 1, 0)
+		}},
+		// 失败的任务按退避重试，次数用尽进入死信，RetryDead 重新入队并清零次数
+		{"RetryDead", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{MaxRetries: 1, BackoffMin: time.Millisecond})
+
+			id, err := q.Enqueue(ctx, refill{UID: 1}, 0)
+			must(t, err)
+			job, err := q.Dequeue(ctx)
+			must(t, err)
+			must(t, q.Nack(ctx, job, errors.New("boom")))
+			queueLen(t, q, 0, 1, 0, 0)
+
+			time.Sleep(5 * time.Millisecond)
+			must(t, q.Maintain(ctx))
+			job, err = q.Dequeue(ctx)
+			must(t, err)
+			equal(t, job.Attempts, 1)
+			equal(t, job.LastError, "boom")
+			must(t, q.Nack(ctx, job, errors.New("boom again")))
+			queueLen(t, q, 0, 0, 0, 1)
+
+			dead, err := q.DeadJobs(ctx, 10)
+			must(t, err)
+			equal(t, len(dead), 1)
+			equal(t, dead[0].ID, id)
+			equal(t, dead[0].Attempts, 2)
+			equal(t, dead[0].LastError, "boom again")
+
+			must(t, q.RetryDead(ctx, id))
+			if err := q.RetryDead(ctx, id); !errors.Is(err, db.ErrNotFound) {
+				t.Fatalf("err = %v, want ErrNotFound", err)
+			}
+			job, err = q.Dequeue(ctx)
+			must(t, err)
+			equal(t, job.Attempts, 0)
+		}},
+		// 超时未 Ack 的任务被回收重试，之后迟到的 Nack 不再重复计数
+		{"VisibilityTimeout", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{Visibility: 20 * time.Millisecond, BackoffMin: time.Hour})
+
+			_, err := q.Enqueue(ctx, refill{}, 0)
+			must(t, err)
+			job, err := q.Dequeue(ctx)
+			must(t, err)
+
+			time.Sleep(30 * time.Millisecond)
+			must(t, q.Maintain(ctx))
+			queueLen(t, q, 0, 1, 0, 0)
+
+			must(t, q.Nack(ctx, job, errors.New("late")))
+			queueLen(t, q, 0, 1, 0, 0)
+		}},
+		// 任务数据丢失的 ID 被丢弃，不会卡住消费者
+		{"DroppedJob", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			q := s.NewQueue("energy", db.QueueOptions{Block: time.Second})
+
+			id, err := q.Enqueue(ctx, refill{}, 0)
+			must(t, err)
+			mr.HDel("queue:{energy}:jobs", id)
+			if _, err := q.Dequeue(ctx); !errors.Is(err, db.ErrQueueEmpty) {
+				t.Fatalf("err = %v, want ErrQueueEmpty", err)
+			}
+			queueLen(t, q, 0, 0, 0, 0)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
+
+// TestQueueRun handler 出错或 panic 时 Nack，成功时 Ack，ctx 取消后 Run 返回
+func TestQueueRun(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	q := s.NewQueue("energy", db.QueueOptions{
+		BackoffMin:  time.Hour,
+		Block:       time.Second,
+		Poll:        10 * time.Millisecond,
+		Concurrency: 2,
+	})
+	for uid := int64(1); uid <= 3; uid++ {
+		_, err := q.Enqueue(ctx, refill{UID: uid}, 0)
+		must(t, err)
+	}
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[int64]bool)
+		done = make(chan struct{})
+	)
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = q.Run(runCtx, func(ctx context.Context, job *db.Job) error {
+			var ev refill
+			if err := job.Decode(&ev); err != nil {
+				return err
+			}
+			mu.Lock()
+			seen[ev.UID] = true
+			if len(seen) == 3 {
+				close(done)
+			}
+			mu.Unlock()
+			switch ev.UID {
+			case 2:
+				return errors.New("boom")
+			case 3:
+				panic("bad job")
+			}
+			return nil
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("jobs not handled")
+	}
+	// 消费协程最多阻塞 Block 后才能看到 ctx 取消
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	queueLen(t, q, 0, 2, 0, 0)
+}
+
+// TestQueueRunAckAfterVisibility handler 用完可见性超时后仍能 Ack
+func TestQueueRunAckAfterVisibility(t *testing.T) {
+	ctx := context.Background()
+	s, _ := dbtest.NewStore(t)
+	q := s.NewQueue("energy", db.QueueOptions{
+		Visibility: 20 * time.Millisecond,
+		Block:      50 * time.Millisecond,
+		Poll:       time.Hour,
+	})
+	_, err := q.Enqueue(ctx, refill{UID: 1}, 0)
+	must(t, err)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		_ = q.Run(runCtx, func(ctx context.Context, job *db.Job) error {
+			<-ctx.Done()
+			return nil
+		})
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		r, d, p, x, err := q.Len(ctx)
+		must(t, err)
+		if r+d+p+x == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("len = %d/%d/%d/%d, want all 0", r, d, p, x)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
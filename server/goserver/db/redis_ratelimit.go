@@ -0,0 +1,317 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	/*
+		滑动窗口：ZSet 记录窗口内每次请求的时间戳（毫秒）。
+		ARGV[1] 当前时间，ARGV[2] 窗口长度，ARGV[3] 上限，ARGV[4] 本次请求的唯一成员。
+		返回 {是否允许, 剩余次数, 需等待的毫秒数}
+	*/
+	slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {1, limit - count - 1, 0}
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, 0, tonumber(oldest[2]) + window - now}`)
+
+	/*
+		令牌桶：Hash 记录剩余令牌与上次更新时间。
+		ARGV[1] 当前时间（毫秒），ARGV[2] 每毫秒生成的令牌数，ARGV[3] 桶容量，ARGV[4] 本次消耗。
+		返回 {是否允许, 剩余令牌（向下取整）, 需等待的毫秒数}
+	*/
+	tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local cost = tonumber(ARGV[4])
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+local wait = 0
+if tokens >= cost then
+	tokens = tokens - cost
+	allowed = 1
+else
+	wait = math.ceil((cost - tokens) / rate)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "ts", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate) + 1000)
+return {allowed, math.floor(tokens), wait}`)
+)
+
+// RateResult 限流结果
+type RateResult struct {
+	Allowed    bool
+	Remaining  int64         // 剩余可用次数 / 令牌数
+	RetryAfter time.Duration // 被拒绝时需等待的时长
+}
+
+func rateResult(vals []interface{}) RateResult {
+	var r RateResult
+	if len(vals) == 3 {
+		allowed, _ := vals[0].(int64)
+		r.Allowed = allowed == 1
+		r.Remaining, _ = vals[1].(int64)
+		wait, _ := vals[2].(int64)
+		r.RetryAfter = time.Duration(wait) * time.Millisecond
+	}
+	return r
+}
+
+/*
+SlidingWindowLimiter 滑动窗口限流，任意 Window 时长内最多 Limit 次，所有节点共享计数。
+精确但每次请求占用一个 ZSet 成员，适合 Limit 较小的业务限制
+
+	// 每个玩家每分钟最多购买 5 次
+	buyLimiter := db.NewSlidingWindowLimiter("rl:buy:", 5, time.Minute)
+	res, err := buyLimiter.Allow(ctx, uid)
+	if err == nil && !res.Allowed {
+		return ErrTooFrequent
+	}
+*/
+type SlidingWindowLimiter struct {
+	store  *RedisStore
+	prefix string
+	limit  int64
+	window time.Duration
+}
+
+// NewSlidingWindowLimiter 创建滑动窗口限流器，key 为 prefix + Allow 传入的 key
+func (s *RedisStore) NewSlidingWindowLimiter(prefix string, limit int64, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{store: s, prefix: prefix, limit: limit, window: window}
+}
+
+// Allow 记录一次请求并返回是否允许，被拒绝的请求不计数
+func (l *SlidingWindowLimiter) Allow(ctx context.Context, key string) (RateResult, error) {
+	member, err := newLockToken()
+	if err != nil {
+		return RateResult{}, err
+	}
+	vals, err := slidingWindowScript.Run(ctx, l.store.rdb, []string{l.prefix + key},
+		time.Now().UnixMilli(), l.window.Milliseconds(), l.limit, member).Slice()
+	if err != nil {
+		return RateResult{}, err
+	}
+	return rateResult(vals), nil
+}
+
+// Reset 清除 key 的计数
+func (l *SlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	return l.store.rdb.Del(ctx, l.prefix+key).Err()
+}
+
+/*
+TokenBucketLimiter 令牌桶限流，以 Rate 个/秒的速度补充令牌，最多积攒 Burst 个，允许短时突发。
+每个 key 只占用一个 Hash，适合高频的全局限流
+
+	// 全服公告接口每秒 100 次，允许突发 200 次
+	limiter := db.NewTokenBucketLimiter("rl:notice:", 100, 200)
+	res, err := limiter.Allow(ctx, "global")
+*/
+type TokenBucketLimiter struct {
+	store  *RedisStore
+	prefix string
+	rate   float64
+	burst  int64
+}
+
+// NewTokenBucketLimiter 创建令牌桶限流器，rate 为每秒补充的令牌数
+func (s *RedisStore) NewTokenBucketLimiter(prefix string, rate float64, burst int64) *TokenBucketLimiter {
+	return &TokenBucketLimiter{store: s, prefix: prefix, rate: rate, burst: burst}
+}
+
+// Allow 消耗 1 个令牌
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string) (RateResult, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN 消耗 n 个令牌，令牌不足时不消耗
+func (l *TokenBucketLimiter) AllowN(ctx context.Context, key string, n int64) (RateResult, error) {
+	if l.rate <= 0 || n > l.burst {
+		return RateResult{}, errors.New("db: token bucket rate must be positive and n must not exceed burst")
+	}
+	vals, err := tokenBucketScript.Run(ctx, l.store.rdb, []string{l.prefix + key},
+		time.Now().UnixMilli(), l.rate/1000, l.burst, n).Slice()
+	if err != nil {
+		return RateResult{}, err
+	}
+	return rateResult(vals), nil
+}
+
+// ---------------- 统计计数 ----------------
+
+// CounterOptions 统计计数配置，零值字段使用默认值
+type CounterOptions struct {
+	Prefix    string         // key 前缀，默认 "stat:"
+	Bucket    time.Duration  // 统计粒度，须为整秒，默认 1 分钟
+	Retention time.Duration  // 每个时间桶的保留时长，默认 7 天
+	Location  *time.Location // 时间桶对齐的时区（如按天统计时以本地 0 点为界），默认 time.Local
+}
+
+// CounterPoint 一个时间桶的统计值
+type CounterPoint struct {
+	Time  time.Time `json:"time"`
+	Value int64     `json:"value"`
+}
+
+/*
+Counter 按时间桶计数，每个桶一个 key，写入时设置过期时间，过期自动清理。
+
+	stat:{name}:<桶开始时间戳>        计数（String，INCRBY）
+	stat:{name}:<桶开始时间戳>:uniq   去重计数（HyperLogLog，PFADD）
+
+	// 每分钟登录次数
+	logins := db.NewCounter("login", db.CounterOptions{})
+	_, _ = logins.Add(ctx, 1)
+
+	// DAU：按天对玩家去重
+	dau := db.NewCounter("dau", db.CounterOptions{Bucket: 24 * time.Hour, Retention: 90 * 24 * time.Hour})
+	_ = dau.AddUnique(ctx, uid)
+	n, _ := dau.Unique(ctx, time.Now())
+
+	// CCU：每个节点每分钟上报一次本节点连接数，同一桶内各节点之和即为全服在线
+	ccu := db.NewCounter("ccu", db.CounterOptions{})
+	_, _ = ccu.Add(ctx, int64(len(wsServer.Clients)))
+*/
+type Counter struct {
+	store *RedisStore
+	name  string
+	opts  CounterOptions
+}
+
+// NewCounter 创建统计计数器。桶的 key 以秒为单位，Bucket 不是整秒（含小于 1 秒）时 panic
+func (s *RedisStore) NewCounter(name string, opts CounterOptions) *Counter {
+	if opts.Prefix == "" {
+		opts.Prefix = "stat:"
+	}
+	if opts.Bucket <= 0 {
+		opts.Bucket = time.Minute
+	}
+	if opts.Bucket%time.Second != 0 {
+		panic(fmt.Sprintf("db: counter %q bucket %v is not a whole number of seconds", name, opts.Bucket))
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	return &Counter{store: s, name: name, opts: opts}
+}
+
+// BucketStart 时间 t 所在桶的开始时间
+func (c *Counter) BucketStart(t time.Time) time.Time {
+	_, offset := t.In(c.opts.Location).Zone()
+	size := int64(c.opts.Bucket / time.Second)
+	local := t.Unix() + int64(offset)
+	start := local - local%size - int64(offset)
+	return time.Unix(start, 0).In(c.opts.Location)
+}
+
+// 使用 hash tag 保证同一计数器的所有桶位于同一 slot，Range 可以一次 MGET
+func (c *Counter) key(t time.Time) string {
+	return fmt.Sprintf("%s{%s}:%d", c.opts.Prefix, c.name, c.BucketStart(t).Unix())
+}
+
+// expireAt 桶结束后再保留 Retention
+func (c *Counter) expireAt(t time.Time) time.Time {
+	return c.BucketStart(t).Add(c.opts.Bucket + c.opts.Retention)
+}
+
+// Add 当前时间桶加 delta，返回加后的值
+func (c *Counter) Add(ctx context.Context, delta int64) (int64, error) {
+	now := time.Now()
+	key := c.key(now)
+	var incr *redis.IntCmd
+	_, err := c.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, delta)
+		pipe.ExpireAt(ctx, key, c.expireAt(now))
+		return nil
+	})
+	return incr.Val(), err
+}
+
+// Get 查询时间 t 所在桶的计数
+func (c *Counter) Get(ctx context.Context, t time.Time) (int64, error) {
+	n, err := c.store.rdb.Get(ctx, c.key(t)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Range 查询 [from, to] 范围内每个桶的计数，没有数据的桶为 0
+func (c *Counter) Range(ctx context.Context, from, to time.Time) ([]CounterPoint, error) {
+	var (
+		points []CounterPoint
+		keys   []string
+	)
+	for t := c.BucketStart(from); !t.After(to); t = t.Add(c.opts.Bucket) {
+		points = append(points, CounterPoint{Time: t})
+		keys = append(keys, c.key(t))
+	}
+	if len(keys) == 0 {
+		return points, nil
+	}
+	vals, err := c.store.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if s, ok := v.(string); ok {
+			points[i].Value, _ = strconv.ParseInt(s, 10, 64)
+		}
+	}
+	return points, nil
+}
+
+// AddUnique 在当前时间桶中记录 member（HyperLogLog，误差约 0.81%）
+func (c *Counter) AddUnique(ctx context.Context, members ...string) error {
+	now := time.Now()
+	key := c.key(now) + ":uniq"
+	args := make([]interface{}, len(members))
+	for i, m := range members {
+		args[i] = m
+	}
+	_, err := c.store.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.PFAdd(ctx, key, args...)
+		pipe.ExpireAt(ctx, key, c.expireAt(now))
+		return nil
+	})
+	return err
+}
+
+// Unique 查询时间 t 所在桶的去重数量
+func (c *Counter) Unique(ctx context.Context, t time.Time) (int64, error) {
+	return c.store.rdb.PFCount(ctx, c.key(t)+":uniq").Result()
+}
+
+// UniqueRange 查询 [from, to] 范围内的去重总数，如用日桶计算 7 日活跃
+func (c *Counter) UniqueRange(ctx context.Context, from, to time.Time) (int64, error) {
+	var keys []string
+	for t := c.BucketStart(from); !t.After(to); t = t.Add(c.opts.Bucket) {
+		keys = append(keys, c.key(t)+":uniq")
+	}
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return c.store.rdb.PFCount(ctx, keys...).Result()
+}
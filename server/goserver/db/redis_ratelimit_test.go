@@ -0,0 +1,238 @@
+package db_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"Allow", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			l := s.NewSlidingWindowLimiter("rl:buy:", 3, time.Minute)
+
+			for want := int64(2); want >= 0; want-- {
+				res, err := l.Allow(ctx, "u1")
+				must(t, err)
+				equal(t, res.Allowed, true)
+				equal(t, res.Remaining, want)
+			}
+			res, err := l.Allow(ctx, "u1")
+			must(t, err)
+			equal(t, res.Allowed, false)
+			if res.RetryAfter <= 0 || res.RetryAfter > time.Minute {
+				t.Fatalf("RetryAfter = %v, want within the window", res.RetryAfter)
+			}
+
+			// 其他 key 独立计数
+			res, err = l.Allow(ctx, "u2")
+			must(t, err)
+			equal(t, res.Allowed, true)
+
+			must(t, l.Reset(ctx, "u1"))
+			res, err = l.Allow(ctx, "u1")
+			must(t, err)
+			equal(t, res.Allowed, true)
+		}},
+		{"Expires", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			l := s.NewSlidingWindowLimiter("rl:buy:", 1, 50*time.Millisecond)
+
+			res, err := l.Allow(ctx, "u1")
+			must(t, err)
+			equal(t, res.Allowed, true)
+			res, err = l.Allow(ctx, "u1")
+			must(t, err)
+			equal(t, res.Allowed, false)
+
+			time.Sleep(60 * time.Millisecond)
+			res, err = l.Allow(ctx, "u1")
+			must(t, err)
+			equal(t, res.Allowed, true)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"Burst", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			l := s.NewTokenBucketLimiter("rl:notice:", 1, 3)
+
+			res, err := l.AllowN(ctx, "g", 3)
+			must(t, err)
+			equal(t, res.Allowed, true)
+			equal(t, res.Remaining, int64(0))
+
+			// 令牌不足时不消耗，等待约 1 个令牌的时间
+			res, err = l.Allow(ctx, "g")
+			must(t, err)
+			equal(t, res.Allowed, false)
+			if res.RetryAfter <= 900*time.Millisecond || res.RetryAfter > time.Second {
+				t.Fatalf("RetryAfter = %v, want about 1s", res.RetryAfter)
+			}
+
+			if _, err := l.AllowN(ctx, "g", 4); err == nil {
+				t.Fatal("n > burst should be rejected")
+			}
+			if _, err := s.NewTokenBucketLimiter("rl:x:", 0, 3).Allow(ctx, "g"); err == nil {
+				t.Fatal("zero rate should be rejected")
+			}
+		}},
+		{"Refill", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			l := s.NewTokenBucketLimiter("rl:notice:", 100, 1)
+
+			res, err := l.Allow(ctx, "g")
+			must(t, err)
+			equal(t, res.Allowed, true)
+			time.Sleep(20 * time.Millisecond)
+			res, err = l.Allow(ctx, "g")
+			must(t, err)
+			equal(t, res.Allowed, true)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
+
+func TestCounter(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"Add", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			c := s.NewCounter("login", db.CounterOptions{Bucket: time.Hour, Retention: time.Hour})
+
+			_, err := c.Add(ctx, 1)
+			must(t, err)
+			n, err := c.Add(ctx, 2)
+			must(t, err)
+			equal(t, n, int64(3))
+			now := time.Now()
+			n, err = c.Get(ctx, now)
+			must(t, err)
+			equal(t, n, int64(3))
+			n, err = c.Get(ctx, now.Add(-2*time.Hour))
+			must(t, err)
+			equal(t, n, int64(0))
+
+			// 桶结束后再保留 Retention
+			key := fmt.Sprintf("stat:{login}:%d", c.BucketStart(now).Unix())
+			if ttl := mr.TTL(key); ttl <= time.Hour || ttl > 2*time.Hour {
+				t.Fatalf("ttl = %v, want between 1h and 2h", ttl)
+			}
+
+			points, err := c.Range(ctx, now.Add(-2*time.Hour), now)
+			must(t, err)
+			equal(t, len(points), 3)
+			equal(t, points[0].Value, int64(0))
+			equal(t, points[2].Value, int64(3))
+			equal(t, points[2].Time.Equal(c.BucketStart(now)), true)
+
+			points, err = c.Range(ctx, now, now.Add(-2*time.Hour))
+			must(t, err)
+			equal(t, len(points), 0)
+		}},
+		{"Unique", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			c := s.NewCounter("dau", db.CounterOptions{Bucket: 24 * time.Hour})
+
+			must(t, c.AddUnique(ctx, "u1", "u2"))
+			must(t, c.AddUnique(ctx, "u2", "u3"))
+			n, err := c.Unique(ctx, time.Now())
+			must(t, err)
+			equal(t, n, int64(3))
+
+			n, err = c.UniqueRange(ctx, time.Now().Add(-6*24*time.Hour), time.Now())
+			must(t, err)
+			equal(t, n, int64(3))
+
+			for _, key := range mr.Keys() {
+				if strings.HasSuffix(key, ":uniq") && mr.TTL(key) <= 0 {
+					t.Fatalf("%s has no ttl", key)
+				}
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
+
+// TestCounterBucketStart 日桶按 Location 的 0 点对齐
+func TestCounterBucketStart(t *testing.T) {
+	s, _ := dbtest.NewStore(t)
+	loc := time.FixedZone("UTC+8", 8*3600)
+	c := s.NewCounter("dau", db.CounterOptions{Bucket: 24 * time.Hour, Location: loc})
+
+	tests := []struct {
+		in, want time.Time
+	}{
+		{time.Date(2026, 10, 19, 3, 0, 0, 0, loc), time.Date(2026, 10, 19, 0, 0, 0, 0, loc)},
+		{time.Date(2026, 10, 19, 23, 59, 59, 0, loc), time.Date(2026, 10, 19, 0, 0, 0, 0, loc)},
+		// UTC 18 日 17:00 是 UTC+8 的 19 日 1:00
+		{time.Date(2026, 10, 18, 17, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 0, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := c.BucketStart(tt.in); !got.Equal(tt.want) {
+			t.Errorf("BucketStart(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// TestCounterInvalidBucket 桶的 key 以秒为单位，小于 1 秒或不是整秒的 Bucket 直接 panic
+func TestCounterInvalidBucket(t *testing.T) {
+	tests := []struct {
+		bucket    time.Duration
+		wantPanic bool
+	}{
+		{0, false},
+		{time.Second, false},
+		{500 * time.Millisecond, true},
+		{1500 * time.Millisecond, true},
+	}
+	s, _ := dbtest.NewStore(t)
+	for _, tt := range tests {
+		t.Run(tt.bucket.String(), func(t *testing.T) {
+			defer func() {
+				if r := recover(); (r != nil) != tt.wantPanic {
+					t.Fatalf("recover() = %v, want panic %v", r, tt.wantPanic)
+				}
+			}()
+			c := s.NewCounter("ccu", db.CounterOptions{Bucket: tt.bucket})
+			now := time.Now()
+			if start := c.BucketStart(now); start.After(now) || now.Sub(start) >= time.Minute {
+				t.Fatalf("BucketStart(%v) = %v", now, start)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"errors"
+	mrand "math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrTxConflict WatchTx 重试次数用尽，被监视的 key 仍在不断被修改
+var ErrTxConflict = errors.New("db: transaction conflict, retries exhausted")
+
+// watchTxRetries WatchTx 遇到冲突时的最大重试次数
+const watchTxRetries = 10
+
+// Pipe 流水线，命令在 Exec 时一次性发送
+type Pipe = redis.Pipeliner
+
+// Tx WATCH 事务，在回调中读取被监视的 key，再通过 TxPipelined 提交写入
+type Tx struct {
+	*redis.Tx
+}
+
+// TxPipelined 以 MULTI/EXEC 提交写入，被监视的 key 在此之前被修改时返回 redis.TxFailedErr
+func (tx Tx) TxPipelined(ctx context.Context, fn func(pipe Pipe) error) ([]redis.Cmder, error) {
+	return tx.Tx.TxPipelined(ctx, fn)
+}
+
+// Pipelined 在一次网络往返中执行 fn 中的所有命令，不保证原子性。
+// 返回所有命令的结果，某条命令失败时 err 为第一个错误
+func (s *RedisStore) Pipelined(ctx context.Context, fn func(pipe Pipe) error) ([]redis.Cmder, error) {
+	return s.rdb.Pipelined(ctx, fn)
+}
+
+// TxPipelined 以 MULTI/EXEC 原子执行 fn 中的所有命令，集群模式下所有 key 须在同一 slot
+func (s *RedisStore) TxPipelined(ctx context.Context, fn func(pipe Pipe) error) ([]redis.Cmder, error) {
+	return s.rdb.TxPipelined(ctx, fn)
+}
+
+// WatchTx 乐观锁事务：WATCH keys 后执行 fn，提交时 key 已被修改则带抖动退避重试，
+// 重试用尽返回 ErrTxConflict。fn 可能执行多次，不要在其中产生外部副作用；fn 返回的错误原样返回且不重试。
+// 集群模式下所有 key 须在同一 slot，可使用 hash tag，如 {uid}:gold、{uid}:bag
+func (s *RedisStore) WatchTx(ctx context.Context, keys []string, fn func(tx Tx) error) error {
+	txf := func(tx *redis.Tx) error {
+		return fn(Tx{tx})
+	}
+	backoff := 5 * time.Millisecond
+	for i := 0; i < watchTxRetries; i++ {
+		err := s.rdb.Watch(ctx, txf, keys...)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff/2 + mrand.N(backoff/2+1)):
+		}
+		backoff = min(backoff*2, 200*time.Millisecond)
+	}
+	return ErrTxConflict
+}
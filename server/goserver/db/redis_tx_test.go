@@ -0,0 +1,104 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+// spend 在 WatchTx 中扣除 gold，before 在读取之后、提交之前执行，用于模拟并发修改
+func spend(ctx context.Context, amount int64, before func()) func(tx db.Tx) error {
+	return func(tx db.Tx) error {
+		gold, err := tx.Get(ctx, "gold").Int64()
+		if err != nil {
+			return err
+		}
+		before()
+		_, err = tx.TxPipelined(ctx, func(pipe db.Pipe) error {
+			pipe.Set(ctx, "gold", gold-amount, 0)
+			return nil
+		})
+		return err
+	}
+}
+
+func TestWatchTx(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		// 被监视的 key 在提交前被修改时重新执行 fn
+		{"Retry", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			must(t, s.Set(ctx, "gold", 100, 0))
+			calls := 0
+			err := s.WatchTx(ctx, []string{"gold"}, spend(ctx, 30, func() {
+				calls++
+				if calls <= 2 {
+					must(t, s.Set(ctx, "gold", 100+calls, 0))
+				}
+			}))
+			must(t, err)
+			equal(t, calls, 3)
+			gold, _ := mr.Get("gold")
+			equal(t, gold, "72")
+		}},
+		{"Conflict", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			must(t, s.Set(ctx, "gold", 100, 0))
+			calls := 0
+			err := s.WatchTx(ctx, []string{"gold"}, spend(ctx, 30, func() {
+				calls++
+				must(t, s.Set(ctx, "gold", 100, 0))
+			}))
+			if !errors.Is(err, db.ErrTxConflict) {
+				t.Fatalf("err = %v, want ErrTxConflict", err)
+			}
+			equal(t, calls, 10)
+			gold, _ := mr.Get("gold")
+			equal(t, gold, "100")
+		}},
+		// fn 的错误原样返回且不重试
+		{"CallbackError", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			boom := errors.New("boom")
+			calls := 0
+			err := s.WatchTx(context.Background(), []string{"gold"}, func(tx db.Tx) error {
+				calls++
+				return boom
+			})
+			if !errors.Is(err, boom) {
+				t.Fatalf("err = %v, want boom", err)
+			}
+			equal(t, calls, 1)
+		}},
+		// 退避等待期间 ctx 结束时立即返回
+		{"Context", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			must(t, s.Set(ctx, "gold", 100, 0))
+			txCtx, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			err := s.WatchTx(txCtx, []string{"gold"}, spend(txCtx, 30, func() {
+				must(t, s.Set(ctx, "gold", 100, 0))
+			}))
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("err = %v, want DeadlineExceeded", err)
+			}
+			if d := time.Since(start); d > 500*time.Millisecond {
+				t.Fatalf("returned after %v, want soon after the deadline", d)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
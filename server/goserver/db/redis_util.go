@@ -3,211 +3,424 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-var (
-	ctx = context.Background()
-	rdb *redis.Client
+type Mode string
+
+const (
+	ModeStandalone Mode = "standalone" // 单机（默认）
+	ModeSentinel   Mode = "sentinel"   // 哨兵
+	ModeCluster    Mode = "cluster"    // 集群
 )
 
 // Config Redis 配置
 type Config struct {
-	Addr     string
+	Mode     Mode   // 部署模式，为空时按单机处理
+	Addr     string // 单机地址
 	Password string
-	DB       int
+	DB       int // 集群模式只支持 0 号库
 	PoolSize int
+
+	MasterName       string   // 哨兵模式：master 名称
+	SentinelAddrs    []string // 哨兵模式：哨兵节点地址
+	SentinelPassword string   // 哨兵模式：哨兵节点密码
+	ClusterAddrs     []string // 集群模式：种子节点地址
+
+	// AllowFlush 允许 FlushDB / FlushAll，默认拒绝。也可通过环境变量 REDIS_ALLOW_FLUSH=1 开启
+	AllowFlush bool
+
+	// Client 使用已创建的客户端（如测试中指向 miniredis 的客户端），不为空时忽略上面的连接配置。
+	// Close 会关闭该客户端
+	Client redis.UniversalClient
 }
 
-// Init 初始化 Redis 客户端
-func Init(cfg Config) {
-	rdb = redis.NewClient(&redis.Options{
-		Addr:         cfg.Addr,
-		Password:     cfg.Password,
-		DB:           cfg.DB,
-		PoolSize:     cfg.PoolSize,
-		MinIdleConns: 5,
-		DialTimeout:  5 * time.Second,
-		ReadTimeout:  3 * time.Second,
-		WriteTimeout: 3 * time.Second,
-	})
+// ErrFlushDisabled 未开启 AllowFlush 时调用 FlushDB / FlushAll
+var ErrFlushDisabled = errors.New("db: flush disabled, set Config.AllowFlush or REDIS_ALLOW_FLUSH=1")
+
+// RedisStore Redis 客户端实例，不同用途（如缓存库、持久库）可各自创建
+type RedisStore struct {
+	rdb        redis.UniversalClient
+	allowFlush bool
+}
+
+// NewRedisStore 创建 Redis 客户端，并通过 PING 检查连通性
+func NewRedisStore(ctx context.Context, cfg Config) (*RedisStore, error) {
+	rdb := cfg.Client
+	if rdb == nil {
+		var err error
+		if rdb, err = newClient(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		_ = rdb.Close()
+		return nil, fmt.Errorf("redis ping (%s): %w", cfg.Mode, err)
+	}
+	allowFlush := cfg.AllowFlush || os.Getenv("REDIS_ALLOW_FLUSH") == "1"
+	return &RedisStore{rdb: rdb, allowFlush: allowFlush}, nil
+}
+
+func newClient(cfg Config) (redis.UniversalClient, error) {
+	switch cfg.Mode {
+	case "", ModeStandalone:
+		return redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: 5,
+			DialTimeout:  5 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+		}), nil
+	case ModeSentinel:
+		if cfg.MasterName == "" || len(cfg.SentinelAddrs) == 0 {
+			return nil, errors.New("redis sentinel: MasterName and SentinelAddrs are required")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.SentinelAddrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			PoolSize:         cfg.PoolSize,
+			MinIdleConns:     5,
+			DialTimeout:      5 * time.Second,
+			ReadTimeout:      3 * time.Second,
+			WriteTimeout:     3 * time.Second,
+		}), nil
+	case ModeCluster:
+		if len(cfg.ClusterAddrs) == 0 {
+			return nil, errors.New("redis cluster: ClusterAddrs is required")
+		}
+		if cfg.DB != 0 {
+			return nil, errors.New("redis cluster: only DB 0 is supported")
+		}
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        cfg.ClusterAddrs,
+			Password:     cfg.Password,
+			PoolSize:     cfg.PoolSize,
+			MinIdleConns: 5,
+			DialTimeout:  5 * time.Second,
+			ReadTimeout:  3 * time.Second,
+			WriteTimeout: 3 * time.Second,
+		}), nil
+	default:
+		return nil, fmt.Errorf("redis: unknown mode %q", cfg.Mode)
+	}
+}
+
+// isCluster 集群模式下多 key 命令不能跨 slot，SCAN/FLUSH 需要在每个 master 上执行
+func (s *RedisStore) isCluster() bool {
+	_, ok := s.rdb.(*redis.ClusterClient)
+	return ok
+}
+
+// forEachMaster 在每个 master 上执行 fn，非集群模式只执行一次。集群模式下 fn 会并发执行
+func (s *RedisStore) forEachMaster(ctx context.Context, fn func(ctx context.Context, c *redis.Client) error) error {
+	switch c := s.rdb.(type) {
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, fn)
+	case *redis.Client:
+		return fn(ctx, c)
+	default:
+		return fmt.Errorf("redis: unsupported client %T", c)
+	}
+}
+
+// Close 关闭客户端及连接池
+func (s *RedisStore) Close() error {
+	return s.rdb.Close()
 }
 
 // ---------------- String ----------------
 
 // Set 设置 key
-func Set(key string, value interface{}, expiration time.Duration) error {
-	return rdb.Set(ctx, key, value, expiration).Err()
+func (s *RedisStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return s.rdb.Set(ctx, key, value, expiration).Err()
 }
 
 // Get 获取 key
-func Get(key string) (string, error) {
-	return rdb.Get(ctx, key).Result()
+func (s *RedisStore) Get(ctx context.Context, key string) (string, error) {
+	return s.rdb.Get(ctx, key).Result()
 }
 
 // Incr 自增
-func Incr(key string) (int64, error) {
-	return rdb.Incr(ctx, key).Result()
+func (s *RedisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.rdb.Incr(ctx, key).Result()
 }
 
 // Decr 自减
-func Decr(key string) (int64, error) {
-	return rdb.Decr(ctx, key).Result()
+func (s *RedisStore) Decr(ctx context.Context, key string) (int64, error) {
+	return s.rdb.Decr(ctx, key).Result()
 }
 
 // ---------------- Hash ----------------
 
-func HSet(key string, values ...interface{}) error {
-	return rdb.HSet(ctx, key, values...).Err()
+func (s *RedisStore) HSet(ctx context.Context, key string, values ...interface{}) error {
+	return s.rdb.HSet(ctx, key, values...).Err()
 }
 
-func HGet(key, field string) (string, error) {
-	return rdb.HGet(ctx, key, field).Result()
+func (s *RedisStore) HGet(ctx context.Context, key, field string) (string, error) {
+	return s.rdb.HGet(ctx, key, field).Result()
 }
 
-func HGetAll(key string) (map[string]string, error) {
-	return rdb.HGetAll(ctx, key).Result()
+func (s *RedisStore) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return s.rdb.HGetAll(ctx, key).Result()
 }
 
 // ---------------- List ----------------
 
-func LPush(key string, values ...interface{}) error {
-	return rdb.LPush(ctx, key, values...).Err()
+func (s *RedisStore) LPush(ctx context.Context, key string, values ...interface{}) error {
+	return s.rdb.LPush(ctx, key, values...).Err()
 }
 
-func RPush(key string, values ...interface{}) error {
-	return rdb.RPush(ctx, key, values...).Err()
+func (s *RedisStore) RPush(ctx context.Context, key string, values ...interface{}) error {
+	return s.rdb.RPush(ctx, key, values...).Err()
 }
 
-func LPop(key string) (string, error) {
-	return rdb.LPop(ctx, key).Result()
+func (s *RedisStore) LPop(ctx context.Context, key string) (string, error) {
+	return s.rdb.LPop(ctx, key).Result()
 }
 
-func LRange(key string, start, stop int64) ([]string, error) {
-	return rdb.LRange(ctx, key, start, stop).Result()
+func (s *RedisStore) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return s.rdb.LRange(ctx, key, start, stop).Result()
 }
 
 // ---------------- Set ----------------
 
-func SAdd(key string, members ...interface{}) error {
-	return rdb.SAdd(ctx, key, members...).Err()
+func (s *RedisStore) SAdd(ctx context.Context, key string, members ...interface{}) error {
+	return s.rdb.SAdd(ctx, key, members...).Err()
 }
 
-func SMembers(key string) ([]string, error) {
-	return rdb.SMembers(ctx, key).Result()
+func (s *RedisStore) SMembers(ctx context.Context, key string) ([]string, error) {
+	return s.rdb.SMembers(ctx, key).Result()
 }
 
-func SIsMember(key string, member interface{}) (bool, error) {
-	return rdb.SIsMember(ctx, key, member).Result()
+func (s *RedisStore) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return s.rdb.SIsMember(ctx, key, member).Result()
 }
 
 // ---------------- ZSet ----------------
 
-func ZAdd(key string, members ...redis.Z) error {
-	return rdb.ZAdd(ctx, key, members...).Err()
+func (s *RedisStore) ZAdd(ctx context.Context, key string, members ...redis.Z) error {
+	return s.rdb.ZAdd(ctx, key, members...).Err()
 }
 
-func ZRangeWithScores(key string, start, stop int64) ([]redis.Z, error) {
-	return rdb.ZRangeWithScores(ctx, key, start, stop).Result()
+func (s *RedisStore) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return s.rdb.ZRangeWithScores(ctx, key, start, stop).Result()
 }
 
-func ZRevRangeWithScores(key string, start, stop int64) ([]redis.Z, error) {
-	return rdb.ZRevRangeWithScores(ctx, key, start, stop).Result()
+func (s *RedisStore) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	return s.rdb.ZRevRangeWithScores(ctx, key, start, stop).Result()
 }
 
 // ---------------- 分布式锁 ----------------
 
 // TryLock 尝试获取锁（过期时间必须设置）
-func TryLock(key, value string, expiration time.Duration) (bool, error) {
-	return rdb.SetNX(ctx, key, value, expiration).Result()
+//
+// Deprecated: 使用 NewLock，带 token 校验与自动续期
+func (s *RedisStore) TryLock(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return s.rdb.SetNX(ctx, key, value, expiration).Result()
 }
 
 // Unlock 释放锁（简单版，没做 value 校验）
-func Unlock(key string) error {
-	return rdb.Del(ctx, key).Err()
+//
+// Deprecated: 使用 NewLock，释放时校验 token
+func (s *RedisStore) Unlock(ctx context.Context, key string) error {
+	return s.rdb.Del(ctx, key).Err()
 }
 
 // ---------------- 发布订阅 ----------------
 
-func Publish(channel, msg string) error {
-	return rdb.Publish(ctx, channel, msg).Err()
+func (s *RedisStore) Publish(ctx context.Context, channel, msg string) error {
+	return s.rdb.Publish(ctx, channel, msg).Err()
 }
 
-func Subscribe(channel string) *redis.PubSub {
-	return rdb.Subscribe(ctx, channel)
+func (s *RedisStore) Subscribe(ctx context.Context, channel string) *redis.PubSub {
+	return s.rdb.Subscribe(ctx, channel)
 }
 
 // ---------------- 清除缓存 ----------------
 
 // Del 删除一个或多个 key
-func Del(keys ...string) (int64, error) {
-	return rdb.Del(ctx, keys...).Result()
+func (s *RedisStore) Del(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) <= 1 || !s.isCluster() {
+		return s.rdb.Del(ctx, keys...).Result()
+	}
+	// 集群模式下逐个删除，由 pipeline 按 slot 分发
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+	return deleted, err
 }
 
 // Expire 设置 key 过期时间
-func Expire(key string, expiration time.Duration) (bool, error) {
-	return rdb.Expire(ctx, key, expiration).Result()
+func (s *RedisStore) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return s.rdb.Expire(ctx, key, expiration).Result()
 }
 
 // TTL 查看 key 剩余过期时间
-func TTL(key string) (time.Duration, error) {
-	return rdb.TTL(ctx, key).Result()
-}
-
-// DelByPrefix 按前缀删除缓存
-func DelByPrefix(prefix string) (int64, error) {
-	var cursor uint64
-	var totalDeleted int64
-	for {
-		// 使用 Scan 遍历匹配的 key，避免阻塞 Redis
-		keys, nextCursor, err := rdb.Scan(ctx, cursor, prefix+"*", 100).Result()
-		if err != nil {
-			return totalDeleted, err
+func (s *RedisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return s.rdb.TTL(ctx, key).Result()
+}
+
+// DelByPrefix 按前缀删除缓存，等同于 DelByPrefixWith(ctx, prefix, DelOptions{})
+func (s *RedisStore) DelByPrefix(ctx context.Context, prefix string) (int64, error) {
+	res, err := s.DelByPrefixWith(ctx, prefix, DelOptions{})
+	return res.Deleted, err
+}
+
+// DelOptions 按前缀删除的选项
+type DelOptions struct {
+	DryRun     bool                // 只返回匹配的 key，不删除
+	BatchSize  int64               // 每次 SCAN 的数量及每批 UNLINK 的 key 数，默认 500
+	OnProgress func(p DelProgress) // 每批处理完回调一次，集群模式下各 master 的回调会串行执行
+	Pause      time.Duration       // 每批之间的间隔，用于降低对线上 Redis 的压力
+}
+
+// DelProgress 按前缀删除的进度
+type DelProgress struct {
+	Scanned int64 // 已匹配的 key 数
+	Deleted int64 // 已删除的 key 数，DryRun 时为 0
+}
+
+// DelResult 按前缀删除的结果
+type DelResult struct {
+	Deleted int64
+	Keys    []string // 仅 DryRun 时返回匹配的 key
+}
+
+// DelByPrefixWith 按前缀删除缓存：SCAN 遍历（集群模式遍历每个 master），按批 pipeline 执行 UNLINK，
+// 大 key 在后台线程释放，不阻塞 Redis。prefix 不能为空，清空整个库请使用 FlushDB
+func (s *RedisStore) DelByPrefixWith(ctx context.Context, prefix string, opts DelOptions) (DelResult, error) {
+	if prefix == "" {
+		return DelResult{}, errors.New("db: DelByPrefix requires a non-empty prefix")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	var (
+		mu       sync.Mutex
+		result   DelResult
+		progress DelProgress
+	)
+	report := func(scanned int64, keys []string, deleted int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress.Scanned += scanned
+		progress.Deleted += deleted
+		result.Deleted += deleted
+		result.Keys = append(result.Keys, keys...)
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
 		}
-		cursor = nextCursor
+	}
 
-		if len(keys) > 0 {
-			deleted, err := rdb.Del(ctx, keys...).Result()
+	err := s.forEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		var cursor uint64
+		for {
+			// 使用 Scan 遍历匹配的 key，避免阻塞 Redis
+			keys, nextCursor, err := node.Scan(ctx, cursor, prefix+"*", opts.BatchSize).Result()
 			if err != nil {
-				return totalDeleted, err
+				return err
+			}
+			cursor = nextCursor
+
+			if len(keys) > 0 {
+				if opts.DryRun {
+					report(int64(len(keys)), keys, 0)
+				} else {
+					deleted, err := unlinkBatch(ctx, node, keys)
+					report(int64(len(keys)), nil, deleted)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// 游标为 0 表示遍历完毕
+			if cursor == 0 {
+				return nil
+			}
+			if opts.Pause > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(opts.Pause):
+				}
 			}
-			totalDeleted += deleted
 		}
+	})
+	return result, err
+}
 
-		// 游标为 0 表示遍历完毕
-		if cursor == 0 {
-			break
+// unlinkBatch 在同一节点上 pipeline 执行 UNLINK，每个 key 一条命令，集群模式下不会跨 slot
+func unlinkBatch(ctx context.Context, node *redis.Client, keys []string) (int64, error) {
+	cmds := make([]*redis.IntCmd, len(keys))
+	_, err := node.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Unlink(ctx, key)
 		}
+		return nil
+	})
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
 	}
-	return totalDeleted, nil
+	return deleted, err
 }
 
-// FlushDB 清空当前数据库
-func FlushDB() error {
-	return rdb.FlushDB(ctx).Err()
+// FlushDB 清空当前数据库，未开启 AllowFlush 时返回 ErrFlushDisabled
+func (s *RedisStore) FlushDB(ctx context.Context) error {
+	if !s.allowFlush {
+		return ErrFlushDisabled
+	}
+	return s.forEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return node.FlushDB(ctx).Err()
+	})
 }
 
-// FlushAll 清空所有数据库（生产环境慎用⚠️）
-func FlushAll() error {
-	return rdb.FlushAll(ctx).Err()
+// FlushAll 清空所有数据库，未开启 AllowFlush 时返回 ErrFlushDisabled（生产环境慎用⚠️）
+func (s *RedisStore) FlushAll(ctx context.Context) error {
+	if !s.allowFlush {
+		return ErrFlushDisabled
+	}
+	return s.forEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		return node.FlushAll(ctx).Err()
+	})
 }
 
 // ---------------- JSON ----------------
 
 // SetJSON 存储结构体（自动序列化）
-func SetJSON(key string, value interface{}, expiration time.Duration) error {
+func (s *RedisStore) SetJSON(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	return rdb.Set(ctx, key, data, expiration).Err()
+	return s.rdb.Set(ctx, key, data, expiration).Err()
 }
 
 // GetJSON 获取结构体（自动反序列化）
-func GetJSON(key string, dest interface{}) error {
-	data, err := rdb.Get(ctx, key).Bytes()
+func (s *RedisStore) GetJSON(ctx context.Context, key string, dest interface{}) error {
+	data, err := s.rdb.Get(ctx, key).Bytes()
 	if err != nil {
 		return err
 	}
@@ -215,17 +428,17 @@ func GetJSON(key string, dest interface{}) error {
 }
 
 // HSetJSON 将结构体存储到 Hash
-func HSetJSON(key string, field string, value interface{}) error {
+func (s *RedisStore) HSetJSON(ctx context.Context, key string, field string, value interface{}) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	return rdb.HSet(ctx, key, field, data).Err()
+	return s.rdb.HSet(ctx, key, field, data).Err()
 }
 
 // HGetJSON 从 Hash 中取结构体
-func HGetJSON(key, field string, dest interface{}) error {
-	data, err := rdb.HGet(ctx, key, field).Bytes()
+func (s *RedisStore) HGetJSON(ctx context.Context, key, field string, dest interface{}) error {
+	data, err := s.rdb.HGet(ctx, key, field).Bytes()
 	if err != nil {
 		return err
 	}
@@ -234,30 +447,64 @@ func HGetJSON(key, field string, dest interface{}) error {
 
 /*--------------------------------------------------------------------
 // 使用示例
-// 初始化
-	redisutil.Init(redisutil.Config{
+// 初始化默认实例（包级函数使用）
+	ctx := context.Background()
+	err := redisutil.Init(ctx, redisutil.Config{
 		Addr:     "localhost:6379",
 		Password: "",
 		DB:       0,
 		PoolSize: 20,
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// 多实例：缓存库与持久库分开
+	cache, err := redisutil.NewRedisStore(ctx, redisutil.Config{Addr: "localhost:6379", DB: 1, PoolSize: 20})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer cache.Close()
+	_ = cache.Set(ctx, "name", "GoRedis", time.Hour)
+
+	// 哨兵模式
+	_ = redisutil.Init(ctx, redisutil.Config{
+		Mode:          redisutil.ModeSentinel,
+		MasterName:    "mymaster",
+		SentinelAddrs: []string{"10.0.0.1:26379", "10.0.0.2:26379", "10.0.0.3:26379"},
+		PoolSize:      20,
+	})
+
+	// 集群模式
+	_ = redisutil.Init(ctx, redisutil.Config{
+		Mode:         redisutil.ModeCluster,
+		ClusterAddrs: []string{"10.0.0.1:7000", "10.0.0.2:7000", "10.0.0.3:7000"},
+		PoolSize:     20,
+	})
 
 	// String
-	redisutil.Set("name", "GoRedis", time.Hour)
-	val, _ := redisutil.Get("name")
+	redisutil.Set(ctx, "name", "GoRedis", time.Hour)
+	val, _ := redisutil.Get(ctx, "name")
 	fmt.Println("name =", val)
 
 	// Hash
-	redisutil.HSet("user:1", "name", "Alice", "age", 20)
-	user, _ := redisutil.HGetAll("user:1")
+	redisutil.HSet(ctx, "user:1", "name", "Alice", "age", 20)
+	user, _ := redisutil.HGetAll(ctx, "user:1")
 	fmt.Println("user =", user)
 
 	// 分布式锁
-	ok, _ := redisutil.TryLock("lock:order", "1", 10*time.Second)
-	if ok {
+	lock := redisutil.NewLock("lock:order", redisutil.LockOptions{TTL: 10 * time.Second})
+	lockCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	if err := lock.Lock(lockCtx); err == nil {
 		fmt.Println("获取锁成功")
-		redisutil.Unlock("lock:order")
+		select {
+		case <-lock.Lost():
+			// 续期失败，锁已被他人持有，应中止任务
+		default:
+		}
+		_ = lock.Unlock(ctx)
 	}
+	cancel()
 
 	type User struct {
 		ID    int    `json:"id"`
@@ -269,74 +516,91 @@ func HGetJSON(key, field string, dest interface{}) error {
 	u := User{ID: 1, Name: "Alice", Age: 20, Email: "alice@test.com"}
 
 	// 存储结构体
-	_ = redisutil.SetJSON("user:1", u, time.Hour)
+	_ = redisutil.SetJSON(ctx, "user:1", u, time.Hour)
 
 	// 读取结构体
 	var u2 User
-	_ = redisutil.GetJSON("user:1", &u2)
+	_ = redisutil.GetJSON(ctx, "user:1", &u2)
 	fmt.Println("User struct:", u2)
 
 	// 存储到 Hash
-	_ = redisutil.HSetJSON("userhash:1", "profile", u)
+	_ = redisutil.HSetJSON(ctx, "userhash:1", "profile", u)
 
 	// 从 Hash 读取
 	var u3 User
-	_ = redisutil.HGetJSON("userhash:1", "profile", &u3)
+	_ = redisutil.HGetJSON(ctx, "userhash:1", "profile", &u3)
 	fmt.Println("User from hash:", u3)
 
 	// 设置 key
-	_ = redisutil.SetJSON("cache:user:1", map[string]string{"name": "Alice"}, time.Minute)
+	_ = redisutil.SetJSON(ctx, "cache:user:1", map[string]string{"name": "Alice"}, time.Minute)
 
 	// 查看 TTL
-	ttl, _ := redisutil.TTL("cache:user:1")
+	ttl, _ := redisutil.TTL(ctx, "cache:user:1")
 	fmt.Println("TTL:", ttl)
 
 	// 修改过期时间
-	ok, _ := redisutil.Expire("cache:user:1", 10*time.Second)
+	ok, _ := redisutil.Expire(ctx, "cache:user:1", 10*time.Second)
 	fmt.Println("Expire set:", ok)
 
 	// 删除 key
-	n, _ := redisutil.Del("cache:user:1")
+	n, _ := redisutil.Del(ctx, "cache:user:1")
 	fmt.Println("Deleted keys:", n)
 
-	// 清空数据库
-	// _ = redisutil.FlushDB()
-	// _ = redisutil.FlushAll()
+	// 清空数据库（需要 Config.AllowFlush 或 REDIS_ALLOW_FLUSH=1）
+	// _ = redisutil.FlushDB(ctx)
+	// _ = redisutil.FlushAll(ctx)
 
 
 	// 批量设置缓存
 	for i := 1; i <= 5; i++ {
 		key := fmt.Sprintf("cache:user:%d", i)
-		_ = redisutil.SetJSON(key, map[string]string{"name": fmt.Sprintf("User%d", i)}, time.Hour)
+		_ = redisutil.SetJSON(ctx, key, map[string]string{"name": fmt.Sprintf("User%d", i)}, time.Hour)
 	}
 
 	// 按前缀删除
-	deleted, _ := redisutil.DelByPrefix("cache:user:")
+	deleted, _ := redisutil.DelByPrefix(ctx, "cache:user:")
 	fmt.Println("Deleted keys count:", deleted)
 
+	// 先 dry-run 确认匹配的 key，再分批删除并打印进度
+	res, _ := redisutil.DelByPrefixWith(ctx, "cache:user:", redisutil.DelOptions{DryRun: true})
+	fmt.Println("Matched keys:", res.Keys)
+	_, _ = redisutil.DelByPrefixWith(ctx, "cache:user:", redisutil.DelOptions{
+		BatchSize:  1000,
+		Pause:      10 * time.Millisecond,
+		OnProgress: func(p redisutil.DelProgress) { fmt.Println("deleted", p.Deleted, "/", p.Scanned) },
+	})
+
 	// 事务与流水线
-	//Pipeline（减少网络往返）
-	pipe := rdb.Pipeline()
-	pipe.Set(ctx, "k1", "v1", 0)
-	pipe.Set(ctx, "k2", "v2", 0)
-	pipe.Incr(ctx, "counter")
-	cmds, err := pipe.Exec(ctx)
-
-	// 事务（乐观锁）
-	txf := func(tx *redis.Tx) error {
-		// 取值
-		n, err := tx.Get(ctx, "counter").Int()
+	// Pipeline（减少网络往返）
+	cmds, err := redisutil.Pipelined(ctx, func(pipe redisutil.Pipe) error {
+		pipe.Set(ctx, "k1", "v1", 0)
+		pipe.Set(ctx, "k2", "v2", 0)
+		pipe.Incr(ctx, "counter")
+		return nil
+	})
+
+	// 事务（乐观锁），key 被其他客户端修改时自动重试
+	err = redisutil.WatchTx(ctx, []string{"gold:1", "bag:1"}, func(tx redisutil.Tx) error {
+		gold, err := tx.Get(ctx, "gold:1").Int64()
 		if err != nil && err != redis.Nil {
 			return err
 		}
-		// 条件更新
-		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-				pipe.Set(ctx, "counter", n+1, 0)
-				return nil
+		if gold < 100 {
+			return ErrNotEnoughGold // 业务错误直接返回，不会重试
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redisutil.Pipe) error {
+			pipe.DecrBy(ctx, "gold:1", 100)
+			pipe.HIncrBy(ctx, "bag:1", "sword", 1)
+			return nil
 		})
 		return err
-	}
+	})
 
-	err := rdb.Watch(ctx, txf, "counter")
+	// key 命名空间：统一前缀、类型与默认 TTL，避免手写 "user:1" 之类的字符串
+	keys := redisutil.NewKeyspace("prod", "coin")
+	userCache := keys.Define("cache:user", redisutil.KeyString, time.Hour)
+	_ = redisutil.SetJSON(ctx, userCache.Key(1), u, userCache.TTL) // prod:coin:cache:user:1
+	issues, _ := redisutil.AuditKeys(ctx, keys, redisutil.AuditOptions{FixTTL: true})
+	fmt.Println("key issues:", issues)
 
 --------------------------------------------------------------------*/
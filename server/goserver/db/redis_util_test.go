@@ -0,0 +1,312 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+type user struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestHelpers(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis)
+	}{
+		{"SetGet", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.Set(ctx, "k", "v", time.Minute))
+			got, err := s.Get(ctx, "k")
+			must(t, err)
+			equal(t, got, "v")
+			equal(t, mr.TTL("k"), time.Minute)
+		}},
+		{"GetMissing", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			_, err := s.Get(ctx, "missing")
+			if !errors.Is(err, redis.Nil) {
+				t.Fatalf("err = %v, want redis.Nil", err)
+			}
+		}},
+		{"IncrDecr", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			n, err := s.Incr(ctx, "n")
+			must(t, err)
+			equal(t, n, int64(1))
+			n, err = s.Decr(ctx, "n")
+			must(t, err)
+			equal(t, n, int64(0))
+		}},
+		{"Hash", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.HSet(ctx, "h", "a", "1", "b", "2"))
+			v, err := s.HGet(ctx, "h", "b")
+			must(t, err)
+			equal(t, v, "2")
+			all, err := s.HGetAll(ctx, "h")
+			must(t, err)
+			equal(t, len(all), 2)
+		}},
+		{"List", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.RPush(ctx, "l", "b", "c"))
+			must(t, s.LPush(ctx, "l", "a"))
+			items, err := s.LRange(ctx, "l", 0, -1)
+			must(t, err)
+			equal(t, fmt.Sprint(items), "[a b c]")
+			v, err := s.LPop(ctx, "l")
+			must(t, err)
+			equal(t, v, "a")
+		}},
+		{"Set", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.SAdd(ctx, "s", "x", "y", "x"))
+			members, err := s.SMembers(ctx, "s")
+			must(t, err)
+			slices.Sort(members)
+			equal(t, fmt.Sprint(members), "[x y]")
+			ok, err := s.SIsMember(ctx, "s", "z")
+			must(t, err)
+			equal(t, ok, false)
+		}},
+		{"ZSet", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.ZAdd(ctx, "z", redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 2, Member: "b"}))
+			asc, err := s.ZRangeWithScores(ctx, "z", 0, -1)
+			must(t, err)
+			equal(t, asc[0].Member, any("a"))
+			desc, err := s.ZRevRangeWithScores(ctx, "z", 0, 0)
+			must(t, err)
+			equal(t, desc[0].Member, any("c"))
+		}},
+		{"JSON", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.SetJSON(ctx, "u", user{"tom", 18}, time.Hour))
+			var u user
+			must(t, s.GetJSON(ctx, "u", &u))
+			equal(t, u, user{"tom", 18})
+		}},
+		{"HashJSON", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.HSetJSON(ctx, "users", "1", user{"amy", 20}))
+			var u user
+			must(t, s.HGetJSON(ctx, "users", "1", &u))
+			equal(t, u, user{"amy", 20})
+		}},
+		{"DelExpireTTL", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			mr.Set("a", "1")
+			mr.Set("b", "1")
+			ok, err := s.Expire(ctx, "a", 10*time.Second)
+			must(t, err)
+			equal(t, ok, true)
+			ttl, err := s.TTL(ctx, "a")
+			must(t, err)
+			equal(t, ttl, 10*time.Second)
+			n, err := s.Del(ctx, "a", "b", "c")
+			must(t, err)
+			equal(t, n, int64(2))
+		}},
+		{"ExpireByTime", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			must(t, s.Set(ctx, "k", "v", time.Second))
+			mr.FastForward(2 * time.Second)
+			_, err := s.Get(ctx, "k")
+			equal(t, errors.Is(err, redis.Nil), true)
+		}},
+		{"DelByPrefix", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			for i := 0; i < 10; i++ {
+				mr.Set(fmt.Sprintf("cache:user:%d", i), "x")
+			}
+			mr.Set("cache:item:1", "x")
+			n, err := s.DelByPrefix(ctx, "cache:user:")
+			must(t, err)
+			equal(t, n, int64(10))
+			equal(t, mr.Exists("cache:item:1"), true)
+		}},
+		{"DelByPrefixDryRun", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			mr.Set("p:1", "x")
+			mr.Set("p:2", "x")
+			var progress db.DelProgress
+			res, err := s.DelByPrefixWith(ctx, "p:", db.DelOptions{DryRun: true, OnProgress: func(p db.DelProgress) { progress = p }})
+			must(t, err)
+			slices.Sort(res.Keys)
+			equal(t, fmt.Sprint(res.Keys), "[p:1 p:2]")
+			equal(t, res.Deleted, int64(0))
+			equal(t, progress.Scanned, int64(2))
+			equal(t, mr.Exists("p:1"), true)
+		}},
+		{"DelByPrefixEmpty", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			if _, err := s.DelByPrefix(ctx, ""); err == nil {
+				t.Fatal("empty prefix should be rejected")
+			}
+		}},
+		{"FlushDB", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			mr.Set("k", "v")
+			must(t, s.FlushDB(ctx))
+			equal(t, len(mr.Keys()), 0)
+		}},
+		{"PipelinedWatchTx", func(t *testing.T, s *db.RedisStore, mr *miniredis.Miniredis) {
+			_, err := s.Pipelined(ctx, func(pipe db.Pipe) error {
+				pipe.Set(ctx, "gold", 100, 0)
+				pipe.HSet(ctx, "bag", "sword", 0)
+				return nil
+			})
+			must(t, err)
+			err = s.WatchTx(ctx, []string{"gold", "bag"}, func(tx db.Tx) error {
+				gold, err := tx.Get(ctx, "gold").Int64()
+				if err != nil {
+					return err
+				}
+				_, err = tx.TxPipelined(ctx, func(pipe db.Pipe) error {
+					pipe.Set(ctx, "gold", gold-30, 0)
+					pipe.HIncrBy(ctx, "bag", "sword", 1)
+					return nil
+				})
+				return err
+			})
+			must(t, err)
+			gold, _ := mr.Get("gold")
+			equal(t, gold, "70")
+			equal(t, mr.HGet("bag", "sword"), "1")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			tt.run(t, s, mr)
+		})
+	}
+}
+
+func TestFlushGuard(t *testing.T) {
+	t.Setenv("REDIS_ALLOW_FLUSH", "")
+	mr := miniredis.RunT(t)
+	s, err := db.NewRedisStore(context.Background(), db.Config{Client: redis.NewClient(&redis.Options{Addr: mr.Addr()})})
+	must(t, err)
+	defer s.Close()
+
+	mr.Set("k", "v")
+	if err := s.FlushDB(context.Background()); !errors.Is(err, db.ErrFlushDisabled) {
+		t.Fatalf("FlushDB err = %v, want ErrFlushDisabled", err)
+	}
+	if err := s.FlushAll(context.Background()); !errors.Is(err, db.ErrFlushDisabled) {
+		t.Fatalf("FlushAll err = %v, want ErrFlushDisabled", err)
+	}
+	equal(t, mr.Exists("k"), true)
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  db.Config
+		want string
+	}{
+		{"SentinelNoMaster", db.Config{Mode: db.ModeSentinel, SentinelAddrs: []string{"127.0.0.1:26379"}}, "MasterName"},
+		{"SentinelNoAddrs", db.Config{Mode: db.ModeSentinel, MasterName: "mymaster"}, "SentinelAddrs"},
+		{"ClusterNoAddrs", db.Config{Mode: db.ModeCluster}, "ClusterAddrs"},
+		{"ClusterDB", db.Config{Mode: db.ModeCluster, ClusterAddrs: []string{"127.0.0.1:7000"}, DB: 1}, "only DB 0"},
+		{"UnknownMode", db.Config{Mode: "replica", Addr: "127.0.0.1:6379"}, `unknown mode "replica"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := db.NewRedisStore(context.Background(), tt.cfg)
+			if err == nil {
+				s.Close()
+				t.Fatal("config should be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestInitPingFails PING 不通时 Init 返回错误且不替换默认实例
+func TestInitPingFails(t *testing.T) {
+	store, _ := dbtest.InitDefault(t)
+	mr := miniredis.RunT(t)
+	mr.SetError("LOADING simulated")
+
+	err := db.Init(context.Background(), db.Config{Addr: mr.Addr()})
+	if err == nil || !strings.Contains(err.Error(), "redis ping") {
+		t.Fatalf("err = %v, want ping failure", err)
+	}
+	equal(t, db.Default(), store)
+}
+
+// TestNotInitialized 未初始化时包级函数返回 ErrNotInitialized 而不是 panic
+func TestNotInitialized(t *testing.T) {
+	dbtest.InitDefault(t)
+	db.SetDefault(nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"Set", func() error { return db.Set(ctx, "k", "v", 0) }},
+		{"Get", func() error { _, err := db.Get(ctx, "k"); return err }},
+		{"Pipelined", func() error {
+			_, err := db.Pipelined(ctx, func(pipe db.Pipe) error {
+				pipe.Set(ctx, "k", "v", 0)
+				return nil
+			})
+			return err
+		}},
+		{"WatchTx", func() error { return db.WatchTx(ctx, []string{"k"}, func(db.Tx) error { return nil }) }},
+		{"Lock", func() error { _, err := db.NewLock("lock:x", db.LockOptions{}).TryLock(ctx); return err }},
+		{"Wallet", func() error { _, err := db.NewWallet(db.WalletOptions{}).Balance(ctx, "u1", "gold"); return err }},
+		{"Publish", func() error { return db.Publish(ctx, "ch", "hi") }},
+		{"Subscribe", func() error {
+			ps := db.Subscribe(ctx, "ch")
+			defer ps.Close()
+			_, err := ps.Receive(ctx)
+			return err
+		}},
+		{"Instrument", func() error { return db.Instrument(db.HookOptions{}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, db.ErrNotInitialized) {
+				t.Fatalf("err = %v, want ErrNotInitialized", err)
+			}
+		})
+	}
+}
+
+// TestDefault 包级函数走默认实例
+func TestDefault(t *testing.T) {
+	ctx := context.Background()
+	_, mr := dbtest.InitDefault(t)
+
+	must(t, db.Set(ctx, "k", "v", 0))
+	got, _ := mr.Get("k")
+	equal(t, got, "v")
+
+	ok, err := db.TryLock(ctx, "lock", "me", time.Second)
+	must(t, err)
+	equal(t, ok, true)
+	ok, err = db.TryLock(ctx, "lock", "other", time.Second)
+	must(t, err)
+	equal(t, ok, false)
+	must(t, db.Unlock(ctx, "lock"))
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func equal[T comparable](t *testing.T, got, want T) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
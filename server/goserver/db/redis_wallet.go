@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("db: insufficient funds")
+	ErrInvalidAmount     = errors.New("db: amount must be positive")
+	// ErrDuplicateTxn 同一 txnID 已经执行过，本次未做任何修改，调用方可视为成功
+	ErrDuplicateTxn = errors.New("db: duplicate transaction")
+	// ErrCrossSlot 集群模式下两个钱包不在同一 slot，无法在一个脚本中原子转账
+	ErrCrossSlot = errors.New("db: transfer across cluster slots is not supported")
+)
+
+// 脚本返回值首元素为状态码
+const (
+	walletOK           = 0
+	walletInsufficient = 1
+	walletDuplicate    = 2
+)
+
+var (
+	/*
+		对同一钱包的多个字段原子加减，同一字段可出现多次并按顺序累计，任一时刻结果小于 0 则全部不生效。
+		KEYS[1] 钱包，KEYS[2] 可选的交易记录；ARGV[1] 交易记录 TTL(ms)，ARGV[2] 字段数 n，
+		之后依次为 field, delta。返回 {状态, 各字段新余额...}，余额不足时返回 {1, field}
+	*/
+	walletApplyScript = redis.NewScript(`
+local n = tonumber(ARGV[2])
+if #KEYS == 2 and redis.call("EXISTS", KEYS[2]) == 1 then
+	local res = {2}
+	for i = 1, n do
+		res[i + 1] = tonumber(redis.call("HGET", KEYS[1], ARGV[1 + i * 2]) or "0")
+	end
+	return res
+end
+local bal = {}
+for i = 1, n do
+	local field = ARGV[1 + i * 2]
+	local cur = bal[field] or tonumber(redis.call("HGET", KEYS[1], field) or "0")
+	local v = cur + tonumber(ARGV[2 + i * 2])
+	if v < 0 then
+		return {1, field}
+	end
+	bal[field] = v
+end
+local res = {0}
+for i = 1, n do
+	res[i + 1] = bal[ARGV[1 + i * 2]]
+end
+for i = 1, n do
+	redis.call("HINCRBY", KEYS[1], ARGV[1 + i * 2], ARGV[2 + i * 2])
+end
+if #KEYS == 2 then
+	redis.call("SET", KEYS[2], "1", "PX", ARGV[1])
+end
+return res`)
+
+	/*
+		从 KEYS[1] 转 ARGV[3] 个 ARGV[2] 到 KEYS[2]，KEYS[3] 为可选的交易记录。
+		返回 {状态, 转出方余额, 转入方余额}。
+		先校验转出方为整数且余额足够，再加转入方：HINCRBY 在值不是整数或溢出时报错且不修改，
+		此时转出方尚未扣除；转出方扣除不会失败，因此不会只改了一边
+	*/
+	walletTransferScript = redis.NewScript(`
+if #KEYS == 3 and redis.call("EXISTS", KEYS[3]) == 1 then
+	return {2, tonumber(redis.call("HGET", KEYS[1], ARGV[2]) or "0"), tonumber(redis.call("HGET", KEYS[2], ARGV[2]) or "0")}
+end
+local amount = tonumber(ARGV[3])
+local raw = redis.call("HGET", KEYS[1], ARGV[2]) or "0"
+if not string.match(raw, "^-?%d+$") then
+	return redis.error_reply("ERR hash value is not an integer")
+end
+if tonumber(raw) < amount then
+	return {1, ARGV[2]}
+end
+local ok, to = pcall(redis.call, "HINCRBY", KEYS[2], ARGV[2], amount)
+if not ok then
+	if type(to) == "table" then
+		return to
+	end
+	return redis.error_reply(tostring(to))
+end
+local from = redis.call("HINCRBY", KEYS[1], ARGV[2], -amount)
+if #KEYS == 3 then
+	redis.call("SET", KEYS[3], "1", "PX", ARGV[1])
+end
+return {0, from, to}`)
+)
+
+// WalletOptions 钱包配置，零值字段使用默认值
+type WalletOptions struct {
+	Prefix string        // key 前缀，默认 "wallet:"
+	TxnTTL time.Duration // 交易记录保留时长，在此期间同一 txnID 重复提交会返回 ErrDuplicateTxn，默认 7 天
+}
+
+// Change 一个字段的变化量，正数增加、负数扣除
+type Change struct {
+	Field string
+	Delta int64
+}
+
+/*
+Wallet 货币与道具数量，每个玩家一个 Hash，字段为货币或道具 ID。
+所有修改通过 Lua 脚本原子执行（EVALSHA，脚本未缓存时自动回退 EVAL），余额永远不会小于 0。
+传入 txnID 的操作是幂等的：同一 txnID 只生效一次，用于支付回调、邮件领取等可能重复提交的场景。
+
+	wallet:{uid}            Hash，字段 -> 数量
+	wallet:{uid}:txn:<id>   已执行的交易记录
+
+Transfer 涉及两个玩家的 key，集群模式下通常不在同一 slot，直接返回 ErrCrossSlot；
+此时可用两次带 txnID 的 Apply（先扣除、后增加，失败时按同一 txnID 重试增加）完成转账
+*/
+type Wallet struct {
+	store *RedisStore
+	opts  WalletOptions
+}
+
+// NewWallet 创建钱包
+func (s *RedisStore) NewWallet(opts WalletOptions) *Wallet {
+	if opts.Prefix == "" {
+		opts.Prefix = "wallet:"
+	}
+	if opts.TxnTTL <= 0 {
+		opts.TxnTTL = 7 * 24 * time.Hour
+	}
+	return &Wallet{store: s, opts: opts}
+}
+
+func (w *Wallet) key(owner string) string {
+	return fmt.Sprintf("%s{%s}", w.opts.Prefix, owner)
+}
+
+func (w *Wallet) txnKey(owner, txnID string) string {
+	return fmt.Sprintf("%s{%s}:txn:%s", w.opts.Prefix, owner, txnID)
+}
+
+// Balance 查询单个字段余额，不存在时为 0
+func (w *Wallet) Balance(ctx context.Context, owner, field string) (int64, error) {
+	n, err := w.store.rdb.HGet(ctx, w.key(owner), field).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return n, err
+}
+
+// Balances 查询所有字段余额
+func (w *Wallet) Balances(ctx context.Context, owner string) (map[string]int64, error) {
+	vals, err := w.store.rdb.HGetAll(ctx, w.key(owner)).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]int64, len(vals))
+	for field, v := range vals {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wallet %s field %s: %w", owner, field, err)
+		}
+		res[field] = n
+	}
+	return res, nil
+}
+
+// Grant 增加 amount，返回新余额。txnID 为空时不做幂等校验
+func (w *Wallet) Grant(ctx context.Context, owner, field string, amount int64, txnID string) (int64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	res, err := w.Apply(ctx, owner, txnID, Change{Field: field, Delta: amount})
+	if len(res) == 0 {
+		return 0, err
+	}
+	return res[0], err
+}
+
+// Debit 扣除 amount，余额不足时返回 ErrInsufficientFunds 且不扣除。txnID 为空时不做幂等校验
+func (w *Wallet) Debit(ctx context.Context, owner, field string, amount int64, txnID string) (int64, error) {
+	if amount <= 0 {
+		return 0, ErrInvalidAmount
+	}
+	res, err := w.Apply(ctx, owner, txnID, Change{Field: field, Delta: -amount})
+	if len(res) == 0 {
+		return 0, err
+	}
+	return res[0], err
+}
+
+/*
+Apply 原子地修改同一玩家的多个字段，任一字段不足时全部不生效并返回 ErrInsufficientFunds。
+返回各字段的新余额，顺序与 changes 一致，同一字段出现多次时均为累计后的余额；
+重复的 txnID 返回 ErrDuplicateTxn 及当前余额
+
+	// 花 100 金币买一把剑
+	_, err := wallet.Apply(ctx, uid, orderID,
+		db.Change{Field: "gold", Delta: -100},
+		db.Change{Field: "item:sword", Delta: 1},
+	)
+*/
+func (w *Wallet) Apply(ctx context.Context, owner, txnID string, changes ...Change) ([]int64, error) {
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	keys := []string{w.key(owner)}
+	if txnID != "" {
+		keys = append(keys, w.txnKey(owner, txnID))
+	}
+	args := make([]interface{}, 0, 2+len(changes)*2)
+	args = append(args, w.opts.TxnTTL.Milliseconds(), len(changes))
+	for _, c := range changes {
+		args = append(args, c.Field, c.Delta)
+	}
+	res, err := walletApplyScript.Run(ctx, w.store.rdb, keys, args...).Slice()
+	if err != nil {
+		return nil, err
+	}
+	return walletResult(owner, res)
+}
+
+// Transfer 从 from 转 amount 到 to，返回双方新余额。余额不足时返回 ErrInsufficientFunds 且不转账，
+// 集群模式下返回 ErrCrossSlot
+func (w *Wallet) Transfer(ctx context.Context, from, to, field string, amount int64, txnID string) (fromBalance, toBalance int64, err error) {
+	if amount <= 0 {
+		return 0, 0, ErrInvalidAmount
+	}
+	if from == to {
+		return 0, 0, errors.New("db: transfer to self")
+	}
+	if w.store.isCluster() {
+		// 跨 slot 的脚本会被 Redis 以 CROSSSLOT 拒绝，提前返回明确的错误
+		return 0, 0, ErrCrossSlot
+	}
+	keys := []string{w.key(from), w.key(to)}
+	if txnID != "" {
+		keys = append(keys, w.txnKey(from, txnID))
+	}
+	vals, err := walletTransferScript.Run(ctx, w.store.rdb, keys, w.opts.TxnTTL.Milliseconds(), field, amount).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	res, err := walletResult(from, vals)
+	if len(res) != 2 {
+		return 0, 0, err
+	}
+	return res[0], res[1], err
+}
+
+// walletResult 解析脚本返回的 {状态, 余额...}
+func walletResult(owner string, vals []interface{}) ([]int64, error) {
+	if len(vals) == 0 {
+		return nil, errors.New("db: empty wallet script result")
+	}
+	status, _ := vals[0].(int64)
+	if status == walletInsufficient {
+		return nil, fmt.Errorf("%w: %s %v", ErrInsufficientFunds, owner, vals[1])
+	}
+	res := make([]int64, len(vals)-1)
+	for i, v := range vals[1:] {
+		res[i], _ = v.(int64)
+	}
+	if status == walletDuplicate {
+		return res, ErrDuplicateTxn
+	}
+	return res, nil
+}
@@ -0,0 +1,476 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ErrVersionConflict 保存时版本号与当前版本不一致，需重新读取后再修改
+var ErrVersionConflict = errors.New("db: version conflict")
+
+var (
+	// 加载到缓存：key 已存在时不覆盖，避免旧数据覆盖尚未落库的新数据。ARGV[4] 为 1 时加载墓碑
+	repoLoadScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+if ARGV[4] == "1" then
+	redis.call("HSET", KEYS[1], "ver", ARGV[2], "del", 1)
+else
+	redis.call("HSET", KEYS[1], "data", ARGV[1], "ver", ARGV[2])
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1`)
+
+	// 保存：校验版本号，写入新数据并标记为脏。脏数据不过期，落库后再恢复 TTL。
+	// 墓碑视为版本 0，新版本号接着墓碑递增，落库时才能覆盖 Mongo 中的墓碑
+	repoSaveScript = redis.NewScript(`
+local cur = tonumber(redis.call("HGET", KEYS[1], "ver") or "0")
+local base = cur
+if redis.call("HEXISTS", KEYS[1], "del") == 1 then
+	base = 0
+end
+if base ~= tonumber(ARGV[2]) then
+	return -1
+end
+redis.call("HDEL", KEYS[1], "del")
+redis.call("HSET", KEYS[1], "data", ARGV[1], "ver", cur + 1)
+redis.call("PERSIST", KEYS[1])
+redis.call("SADD", KEYS[2], ARGV[3])
+return cur + 1`)
+
+	// 删除：把记录换成版本号加 1 的墓碑并标记为脏，返回墓碑版本号。
+	// 未缓存时以 ARGV[2]（Mongo 中的版本号）为基准，ARGV[2] 为空则返回 -1
+	repoDeleteScript = redis.NewScript(`
+local cur = redis.call("HGET", KEYS[1], "ver")
+if cur then
+	if redis.call("HEXISTS", KEYS[1], "del") == 1 then
+		return tonumber(cur)
+	end
+	cur = tonumber(cur)
+elseif ARGV[2] == "" then
+	return -1
+else
+	cur = tonumber(ARGV[2])
+end
+redis.call("DEL", KEYS[1])
+redis.call("HSET", KEYS[1], "ver", cur + 1, "del", 1)
+redis.call("SADD", KEYS[2], ARGV[1])
+return cur + 1`)
+
+	// 清除已不存在的记录的脏标记：KEYS[1] 为脏集合，KEYS[i+1] 为 ARGV[i] 的记录，期间被重新创建的保留
+	repoOrphanScript = redis.NewScript(`
+local n = 0
+for i, id in ipairs(ARGV) do
+	if redis.call("EXISTS", KEYS[i + 1]) == 0 then
+		n = n + redis.call("SREM", KEYS[1], id)
+	end
+end
+return n`)
+
+	// 落库完成：版本未变化才清除脏标记，期间有新写入则留到下一轮
+	repoCleanScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "ver") == ARGV[1] then
+	redis.call("SREM", KEYS[2], ARGV[2])
+	redis.call("PEXPIRE", KEYS[1], ARGV[3])
+	return 1
+end
+return 0`)
+)
+
+// RepositoryOptions 仓库配置，零值字段使用默认值
+type RepositoryOptions struct {
+	Prefix    string        // key 前缀，默认 "repo:"
+	Interval  time.Duration // 脏数据落库间隔，默认 5s
+	BatchSize int64         // 每批落库的记录数，默认 100
+	TTL       time.Duration // 已落库记录在 Redis 中的缓存时长，默认 24h
+}
+
+// recordVersion 只读取版本号与删除标记，也用作 Mongo 中的墓碑文档
+type recordVersion struct {
+	ID      string `bson:"_id"`
+	Version int64  `bson:"ver"`
+	Deleted bool   `bson:"deleted,omitempty"`
+}
+
+// Record 仓库中的一条记录，Version 每次保存加 1
+type Record[T any] struct {
+	ID      string `bson:"_id"`
+	Version int64  `bson:"ver"`
+	Data    T      `bson:"data"`
+}
+
+// storedRecord Mongo 中的文档，可能是墓碑
+type storedRecord[T any] struct {
+	Record[T] `bson:",inline"`
+	Deleted   bool `bson:"deleted,omitempty"`
+}
+
+// errDeleted 缓存中是墓碑，无需再查 Mongo
+var errDeleted = fmt.Errorf("%w: deleted", ErrNotFound)
+
+/*
+Repository 以 Redis 为读写缓存、Mongo 为持久存储的仓库（write-behind）。
+
+	repo:{name}:<id>   Hash，data 为 JSON，ver 为版本号；del 表示墓碑
+	repo:{name}:dirty  未落库的记录 ID
+
+读取时先查 Redis，未命中从 Mongo 加载；保存只写 Redis 并标记为脏，由 Run 定期批量写回 Mongo。
+保存需带上读取时的版本号，版本不一致返回 ErrVersionConflict；写回 Mongo 时也按版本号过滤，
+多个节点同时落库或旧批次晚到都不会覆盖新数据。
+删除同样按版本号写入墓碑（Mongo 中为 {_id, ver, deleted: true} 的文档），删除前读出、晚到的旧批次不会把记录写回；
+墓碑会一直保留在 Mongo 中，数量较多时可按需清理早已删除的墓碑。
+同一仓库的 key 使用同一个 hash tag，集群中位于同一 slot
+*/
+type Repository[T any] struct {
+	redis *RedisStore
+	coll  MongoCollection
+	name  string
+	opts  RepositoryOptions
+}
+
+// NewRepository 创建仓库，name 用于 Redis key 前缀，通常与集合名相同
+func NewRepository[T any](rs *RedisStore, coll MongoCollection, name string, opts RepositoryOptions) *Repository[T] {
+	if opts.Prefix == "" {
+		opts.Prefix = "repo:"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	return &Repository[T]{redis: rs, coll: coll, name: name, opts: opts}
+}
+
+func (r *Repository[T]) key(id string) string {
+	return fmt.Sprintf("%s{%s}:%s", r.opts.Prefix, r.name, id)
+}
+
+func (r *Repository[T]) dirtyKey() string {
+	return fmt.Sprintf("%s{%s}:dirty", r.opts.Prefix, r.name)
+}
+
+// Get 读取记录，Redis 未命中时从 Mongo 加载并写入缓存，都不存在时返回 ErrNotFound
+func (r *Repository[T]) Get(ctx context.Context, id string) (Record[T], error) {
+	rec, err := r.getCached(ctx, id)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, errDeleted) {
+		return rec, err
+	}
+
+	doc, err := FindOne[storedRecord[T]](ctx, r.coll, bson.M{"_id": id})
+	if err != nil {
+		return rec, err
+	}
+	data, err := json.Marshal(doc.Data)
+	if err != nil {
+		return rec, err
+	}
+	ok, err := repoLoadScript.Run(ctx, r.redis.rdb, []string{r.key(id)}, data, doc.Version, r.opts.TTL.Milliseconds(), doc.Deleted).Bool()
+	if err != nil {
+		return rec, err
+	}
+	if !ok {
+		// 并发加载或保存已写入缓存，以缓存为准
+		return r.getCached(ctx, id)
+	}
+	if doc.Deleted {
+		return rec, errDeleted
+	}
+	return doc.Record, nil
+}
+
+func (r *Repository[T]) getCached(ctx context.Context, id string) (Record[T], error) {
+	rec := Record[T]{ID: id}
+	vals, err := r.redis.rdb.HMGet(ctx, r.key(id), "data", "ver", "del").Result()
+	if err != nil {
+		return rec, err
+	}
+	if vals[2] != nil {
+		return rec, errDeleted
+	}
+	data, ok1 := vals[0].(string)
+	ver, ok2 := vals[1].(string)
+	if !ok1 || !ok2 {
+		return rec, ErrNotFound
+	}
+	if rec.Version, err = strconv.ParseInt(ver, 10, 64); err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal([]byte(data), &rec.Data)
+	return rec, err
+}
+
+// Save 保存记录，rec.Version 须为读取时的版本号（新记录为 0），成功后 rec.Version 更新为新版本号
+func (r *Repository[T]) Save(ctx context.Context, rec *Record[T]) error {
+	if rec.Version == 0 {
+		// 缓存过期后 Redis 中没有版本号，须确认 Mongo 中也不存在，否则新记录会覆盖已落库的数据
+		doc, err := FindOne[recordVersion](ctx, r.coll, bson.M{"_id": rec.ID}, options.FindOne().SetProjection(bson.M{"ver": 1, "deleted": 1}))
+		switch {
+		case err == nil && !doc.Deleted:
+			return ErrVersionConflict
+		case err == nil:
+			// 已删除：先缓存墓碑，新版本号接着墓碑递增
+			err = repoLoadScript.Run(ctx, r.redis.rdb, []string{r.key(rec.ID)}, "", doc.Version, r.opts.TTL.Milliseconds(), true).Err()
+			if err != nil {
+				return err
+			}
+		case !errors.Is(err, ErrNotFound):
+			return err
+		}
+	}
+	data, err := json.Marshal(rec.Data)
+	if err != nil {
+		return err
+	}
+	ver, err := repoSaveScript.Run(ctx, r.redis.rdb, []string{r.key(rec.ID), r.dirtyKey()}, data, rec.Version, rec.ID).Int64()
+	if err != nil {
+		return err
+	}
+	if ver < 0 {
+		return ErrVersionConflict
+	}
+	rec.Version = ver
+	return nil
+}
+
+// Delete 删除记录：在 Redis 中写入墓碑后立即落库到 Mongo，落库失败时墓碑保持为脏，由 Run 重试
+func (r *Repository[T]) Delete(ctx context.Context, id string) error {
+	keys := []string{r.key(id), r.dirtyKey()}
+	ver, err := repoDeleteScript.Run(ctx, r.redis.rdb, keys, id, "").Int64()
+	if err != nil {
+		return err
+	}
+	if ver < 0 {
+		// 未缓存：以 Mongo 中的版本号为基准写墓碑
+		doc, err := FindOne[recordVersion](ctx, r.coll, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{"ver": 1, "deleted": 1}))
+		if errors.Is(err, ErrNotFound) || err == nil && doc.Deleted {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := repoDeleteScript.Run(ctx, r.redis.rdb, keys, id, doc.Version).Err(); err != nil {
+			return err
+		}
+	}
+	_, err = r.flushBatch(ctx, []string{id})
+	return err
+}
+
+// Flush 把所有脏记录分批写回 Mongo，返回写回的记录数
+func (r *Repository[T]) Flush(ctx context.Context) (int, error) {
+	var (
+		cursor uint64
+		total  int
+		errs   []error
+	)
+	for {
+		ids, next, err := r.redis.rdb.SScan(ctx, r.dirtyKey(), cursor, "", r.opts.BatchSize).Result()
+		if err != nil {
+			return total, err
+		}
+		if len(ids) > 0 {
+			n, err := r.flushBatch(ctx, ids)
+			total += n
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if next == 0 {
+			return total, errors.Join(errs...)
+		}
+		cursor = next
+	}
+}
+
+func (r *Repository[T]) flushBatch(ctx context.Context, ids []string) (int, error) {
+	pipe := r.redis.rdb.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HMGet(ctx, r.key(id), "data", "ver", "del")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	var (
+		models   []mongo.WriteModel
+		flushed  []recordVersion
+		orphaned []string
+	)
+	for i, cmd := range cmds {
+		data, ok1 := cmd.Val()[0].(string)
+		ver, ok2 := cmd.Val()[1].(string)
+		deleted := cmd.Val()[2] != nil
+		if !ok2 || !ok1 && !deleted {
+			// 缓存已丢失
+			orphaned = append(orphaned, ids[i])
+			continue
+		}
+		v, err := strconv.ParseInt(ver, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if deleted {
+			tomb := recordVersion{ID: ids[i], Version: v, Deleted: true}
+			models = append(models, mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"_id": tomb.ID, "ver": bson.M{"$lt": tomb.Version}}).
+				SetReplacement(tomb).
+				SetUpsert(true))
+			flushed = append(flushed, tomb)
+			continue
+		}
+		var rec Record[T]
+		if err := json.Unmarshal([]byte(data), &rec.Data); err != nil {
+			return 0, fmt.Errorf("repo %s decode %s: %w", r.name, ids[i], err)
+		}
+		rec.ID, rec.Version = ids[i], v
+		// 只覆盖版本更低的文档；Mongo 中版本相同或更高时 upsert 会因 _id 冲突失败
+		models = append(models, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": rec.ID, "ver": bson.M{"$lt": rec.Version}}).
+			SetReplacement(rec).
+			SetUpsert(true))
+		flushed = append(flushed, recordVersion{ID: rec.ID, Version: rec.Version})
+	}
+	if len(orphaned) > 0 {
+		keys := []string{r.dirtyKey()}
+		args := make([]interface{}, len(orphaned))
+		for i, id := range orphaned {
+			keys = append(keys, r.key(id))
+			args[i] = id
+		}
+		if err := repoOrphanScript.Run(ctx, r.redis.rdb, keys, args...).Err(); err != nil {
+			log.Printf("repo %s clean orphaned err: %v", r.name, err)
+		}
+	}
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	failed := make(map[int]bool)
+	stale := make(map[int]bool)
+	var errs []error
+	_, err := r.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) || bwe.WriteConcernError != nil {
+			return 0, err
+		}
+		var dups []int
+		for _, we := range bwe.WriteErrors {
+			if mongo.IsDuplicateKeyError(we) {
+				dups = append(dups, we.Index)
+				continue
+			}
+			failed[we.Index] = true
+			log.Printf("repo %s flush %s err: %v", r.name, flushed[we.Index].ID, we)
+		}
+		if err := r.checkFlushed(ctx, flushed, dups, failed, stale); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	n := 0
+	for i, rec := range flushed {
+		if failed[i] || stale[i] {
+			continue
+		}
+		n++
+		err := repoCleanScript.Run(ctx, r.redis.rdb, []string{r.key(rec.ID), r.dirtyKey()},
+			rec.Version, rec.ID, r.opts.TTL.Milliseconds()).Err()
+		if err != nil {
+			return n, err
+		}
+	}
+	if len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("repo %s: %d records failed to flush", r.name, len(failed)))
+	}
+	return n, errors.Join(errs...)
+}
+
+/*
+checkFlushed 处理 _id 冲突的记录：Mongo 中版本与缓存相同说明其他节点已落库；
+版本更高且缓存已有更新的版本（例如读出后被删除）说明本批次已过期，跳过即可；
+否则缓存中的数据基于旧版本（例如缓存丢失后重新创建），不能覆盖，
+记录保持为脏并返回 ErrVersionConflict，需人工处理或删除缓存后重新读取
+*/
+func (r *Repository[T]) checkFlushed(ctx context.Context, flushed []recordVersion, dups []int, failed, stale map[int]bool) error {
+	if len(dups) == 0 {
+		return nil
+	}
+	ids := make([]string, len(dups))
+	for i, idx := range dups {
+		ids[i] = flushed[idx].ID
+	}
+	stored, err := FindAll[recordVersion](ctx, r.coll, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"ver": 1}))
+	if err != nil {
+		for _, idx := range dups {
+			failed[idx] = true
+		}
+		return err
+	}
+	versions := make(map[string]int64, len(stored))
+	for _, s := range stored {
+		versions[s.ID] = s.Version
+	}
+	pipe := r.redis.rdb.Pipeline()
+	cached := make(map[int]*redis.StringCmd)
+	for _, idx := range dups {
+		if rec := flushed[idx]; versions[rec.ID] > rec.Version {
+			cached[idx] = pipe.HGet(ctx, r.key(rec.ID), "ver")
+		}
+	}
+	if len(cached) > 0 {
+		// redis.Nil 留给下面按冲突处理
+		_, _ = pipe.Exec(ctx)
+	}
+	var errs []error
+	for _, idx := range dups {
+		rec := flushed[idx]
+		if versions[rec.ID] == rec.Version {
+			continue
+		}
+		if cmd := cached[idx]; cmd != nil {
+			if v, err := cmd.Int64(); err == nil && v > rec.Version {
+				stale[idx] = true
+				continue
+			}
+		}
+		failed[idx] = true
+		errs = append(errs, fmt.Errorf("repo %s flush %s ver %d, stored ver %d: %w", r.name, rec.ID, rec.Version, versions[rec.ID], ErrVersionConflict))
+	}
+	return errors.Join(errs...)
+}
+
+// Run 每隔 Interval 落库一次，ctx 取消后执行最后一次落库再返回
+func (r *Repository[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_, err := r.Flush(flushCtx)
+			return err
+		case <-ticker.C:
+			if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("repo %s flush err: %v", r.name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+)
+
+type profile struct {
+	Name  string `json:"name" bson:"name"`
+	Level int    `json:"level" bson:"level"`
+}
+
+func newRepo(t *testing.T) (*db.Repository[profile], *dbtest.Collection, *miniredis.Miniredis) {
+	s, mr := dbtest.NewStore(t)
+	coll := dbtest.NewCollection()
+	return db.NewRepository[profile](s, coll, "players", db.RepositoryOptions{TTL: time.Hour}), coll, mr
+}
+
+func stored(t *testing.T, coll *dbtest.Collection, id string) db.Record[profile] {
+	t.Helper()
+	rec, err := db.FindOne[db.Record[profile]](context.Background(), coll, bson.M{"_id": id})
+	must(t, err)
+	return rec
+}
+
+func TestRepositorySaveFlush(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, mr := newRepo(t)
+
+	rec := db.Record[profile]{ID: "p1", Data: profile{"tom", 1}}
+	must(t, repo.Save(ctx, &rec))
+	equal(t, rec.Version, int64(1))
+	// 脏数据不过期
+	equal(t, mr.TTL("repo:{players}:p1"), time.Duration(0))
+
+	rec.Data.Level = 2
+	must(t, repo.Save(ctx, &rec))
+	stale := db.Record[profile]{ID: "p1", Version: 1, Data: profile{"tom", 9}}
+	if err := repo.Save(ctx, &stale); !errors.Is(err, db.ErrVersionConflict) {
+		t.Fatalf("Save err = %v, want ErrVersionConflict", err)
+	}
+
+	n, err := repo.Flush(ctx)
+	must(t, err)
+	equal(t, n, 1)
+	equal(t, stored(t, coll, "p1"), db.Record[profile]{ID: "p1", Version: 2, Data: profile{"tom", 2}})
+	equal(t, mr.TTL("repo:{players}:p1"), time.Hour)
+	ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+	equal(t, ok, false)
+
+	// 缓存过期后从 Mongo 加载
+	mr.FastForward(time.Hour)
+	got, err := repo.Get(ctx, "p1")
+	must(t, err)
+	equal(t, got, db.Record[profile]{ID: "p1", Version: 2, Data: profile{"tom", 2}})
+
+	if _, err := repo.Get(ctx, "p404"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Get err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestRepositoryCreateAfterEviction 缓存过期后以版本 0 保存已落库的记录，返回冲突而不是覆盖
+func TestRepositoryCreateAfterEviction(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, _ := newRepo(t)
+	must(t, db.Insert(ctx, coll, db.Record[profile]{ID: "p1", Version: 3, Data: profile{"tom", 30}}))
+
+	rec := db.Record[profile]{ID: "p1", Data: profile{"new", 1}}
+	if err := repo.Save(ctx, &rec); !errors.Is(err, db.ErrVersionConflict) {
+		t.Fatalf("Save err = %v, want ErrVersionConflict", err)
+	}
+
+	rec, err := repo.Get(ctx, "p1")
+	must(t, err)
+	equal(t, rec.Version, int64(3))
+	rec.Data.Level++
+	must(t, repo.Save(ctx, &rec))
+	_, err = repo.Flush(ctx)
+	must(t, err)
+	equal(t, stored(t, coll, "p1"), db.Record[profile]{ID: "p1", Version: 4, Data: profile{"tom", 31}})
+}
+
+// TestRepositoryFlushConflict Mongo 中版本更高时不覆盖，记录保持为脏
+func TestRepositoryFlushConflict(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, mr := newRepo(t)
+	must(t, db.Insert(ctx, coll, db.Record[profile]{ID: "p1", Version: 5, Data: profile{"tom", 50}}))
+	mr.HSet("repo:{players}:p1", "data", `{"name":"old","level":1}`, "ver", "2")
+	mr.SAdd("repo:{players}:dirty", "p1")
+
+	n, err := repo.Flush(ctx)
+	if !errors.Is(err, db.ErrVersionConflict) {
+		t.Fatalf("Flush err = %v, want ErrVersionConflict", err)
+	}
+	equal(t, n, 0)
+	equal(t, stored(t, coll, "p1").Version, int64(5))
+	ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+	equal(t, ok, true)
+}
+
+// TestRepositoryFlushedElsewhere 其他节点已写入相同版本时视为已落库
+func TestRepositoryFlushedElsewhere(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, mr := newRepo(t)
+	must(t, db.Insert(ctx, coll, db.Record[profile]{ID: "p1", Version: 2, Data: profile{"tom", 2}}))
+	mr.HSet("repo:{players}:p1", "data", `{"name":"tom","level":2}`, "ver", "2")
+	mr.SAdd("repo:{players}:dirty", "p1")
+
+	n, err := repo.Flush(ctx)
+	must(t, err)
+	equal(t, n, 1)
+	ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+	equal(t, ok, false)
+}
+
+func TestRepositoryFlushMongoDown(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, mr := newRepo(t)
+	rec := db.Record[profile]{ID: "p1", Data: profile{"tom", 1}}
+	must(t, repo.Save(ctx, &rec))
+
+	down := errors.New("mongo down")
+	coll.SetError(down)
+	if _, err := repo.Flush(ctx); !errors.Is(err, down) {
+		t.Fatalf("Flush err = %v, want %v", err, down)
+	}
+	ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+	equal(t, ok, true)
+
+	coll.SetError(nil)
+	n, err := repo.Flush(ctx)
+	must(t, err)
+	equal(t, n, 1)
+	equal(t, coll.Len(), 1)
+}
+
+// tombstone Mongo 中墓碑的版本号与删除标记
+type tombstone struct {
+	Version int64 `bson:"ver"`
+	Deleted bool  `bson:"deleted"`
+}
+
+func storedTomb(t *testing.T, coll *dbtest.Collection, id string) tombstone {
+	t.Helper()
+	tomb, err := db.FindOne[tombstone](context.Background(), coll, bson.M{"_id": id})
+	must(t, err)
+	return tomb
+}
+
+func TestRepositoryDelete(t *testing.T) {
+	ctx := context.Background()
+	repo, coll, mr := newRepo(t)
+	rec := db.Record[profile]{ID: "p1", Data: profile{"tom", 1}}
+	must(t, repo.Save(ctx, &rec))
+	_, err := repo.Flush(ctx)
+	must(t, err)
+
+	must(t, repo.Delete(ctx, "p1"))
+	equal(t, storedTomb(t, coll, "p1"), tombstone{2, true})
+	equal(t, mr.TTL("repo:{players}:p1"), time.Hour)
+	ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+	equal(t, ok, false)
+	if _, err := repo.Get(ctx, "p1"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Get err = %v, want ErrNotFound", err)
+	}
+	must(t, repo.Delete(ctx, "p1"))
+	equal(t, storedTomb(t, coll, "p1"), tombstone{2, true})
+
+	// 墓碑缓存过期后仍读不到，重新创建时版本号接着墓碑递增
+	mr.FastForward(time.Hour)
+	if _, err := repo.Get(ctx, "p1"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Get err = %v, want ErrNotFound", err)
+	}
+	mr.FastForward(time.Hour)
+	rec = db.Record[profile]{ID: "p1", Data: profile{"amy", 1}}
+	must(t, repo.Save(ctx, &rec))
+	equal(t, rec.Version, int64(3))
+	_, err = repo.Flush(ctx)
+	must(t, err)
+	equal(t, stored(t, coll, "p1"), db.Record[profile]{ID: "p1", Version: 3, Data: profile{"amy", 1}})
+
+	// 未缓存的记录以 Mongo 中的版本号为基准删除
+	mr.FastForward(time.Hour)
+	must(t, repo.Delete(ctx, "p1"))
+	equal(t, storedTomb(t, coll, "p1"), tombstone{4, true})
+	must(t, repo.Delete(ctx, "p404"))
+	equal(t, coll.Len(), 1)
+}
+
+// TestRepositoryDeleteInterleave Flush 读出记录后、写回 Mongo 前发生的删除或重新创建
+func TestRepositoryDeleteInterleave(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s *db.RedisStore, repo *db.Repository[profile], coll *dbtest.Collection, mr *miniredis.Miniredis)
+	}{
+		// 晚到的旧批次不能把已删除的记录写回
+		{"DeleteDuringFlush", func(t *testing.T, s *db.RedisStore, repo *db.Repository[profile], coll *dbtest.Collection, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			rec := db.Record[profile]{ID: "p1", Data: profile{"tom", 1}}
+			must(t, repo.Save(ctx, &rec))
+			s.AfterPipeline(func() { must(t, repo.Delete(ctx, "p1")) })
+
+			n, err := repo.Flush(ctx)
+			must(t, err)
+			equal(t, n, 0)
+			equal(t, storedTomb(t, coll, "p1"), tombstone{2, true})
+			ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+			equal(t, ok, false)
+			if _, err := repo.Get(ctx, "p1"); !errors.Is(err, db.ErrNotFound) {
+				t.Fatalf("Get err = %v, want ErrNotFound", err)
+			}
+		}},
+		// 缓存丢失的脏记录在清理前被重新创建，脏标记须保留
+		{"RecreateDuringOrphanClean", func(t *testing.T, s *db.RedisStore, repo *db.Repository[profile], coll *dbtest.Collection, mr *miniredis.Miniredis) {
+			ctx := context.Background()
+			mr.SAdd("repo:{players}:dirty", "p1")
+			s.AfterPipeline(func() {
+				rec := db.Record[profile]{ID: "p1", Data: profile{"amy", 1}}
+				must(t, repo.Save(ctx, &rec))
+			})
+
+			n, err := repo.Flush(ctx)
+			must(t, err)
+			equal(t, n, 0)
+			ok, _ := mr.SIsMember("repo:{players}:dirty", "p1")
+			equal(t, ok, true)
+
+			n, err = repo.Flush(ctx)
+			must(t, err)
+			equal(t, n, 1)
+			equal(t, stored(t, coll, "p1"), db.Record[profile]{ID: "p1", Version: 1, Data: profile{"amy", 1}})
+		}},
+		// 没有重新创建时照常清除
+		{"OrphanClean", func(t *testing.T, s *db.RedisStore, repo *db.Repository[profile], coll *dbtest.Collection, mr *miniredis.Miniredis) {
+			mr.SAdd("repo:{players}:dirty", "p1")
+			n, err := repo.Flush(context.Background())
+			must(t, err)
+			equal(t, n, 0)
+			equal(t, mr.Exists("repo:{players}:dirty"), false)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mr := dbtest.NewStore(t)
+			coll := dbtest.NewCollection()
+			repo := db.NewRepository[profile](s, coll, "players", db.RepositoryOptions{TTL: time.Hour})
+			tt.run(t, s, repo, coll, mr)
+		})
+	}
+}
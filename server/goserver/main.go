@@ -1,20 +1,52 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"unsafe"
+	"log"
+	"net/http"
+	"os"
 
+	"goserver/db"
+	"goserver/msgdef"
 	"goserver/wsnet"
 )
 
+type sysHandler struct{}
+
 func main() {
+	// Redis 地址由环境变量 REDIS_ADDR 指定，未设置时不初始化 db 默认实例
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		if err := db.Init(context.Background(), db.Config{Addr: addr, Password: os.Getenv("REDIS_PASSWORD")}); err != nil {
+			log.Fatalf("redis init err: %v", err)
+		}
+		if err := db.Instrument(db.HookOptions{}); err != nil {
+			log.Fatalf("redis instrument err: %v", err)
+		}
+	} else {
+		log.Println("REDIS_ADDR not set, redis disabled")
+	}
+
+	// Prometheus 指标使用独立的 ServeMux，避免与占用 DefaultServeMux 的 WebSocket 服务混在一起
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", db.MetricsHandler())
+		log.Println(http.ListenAndServe(":9100", mux))
+	}()
+
+	router := wsnet.NewRouter()
+	msgdef.Register(router, sysHandler{})
+
 	var wsServer = wsnet.NewWsServer()
-	wsServer.SetCallback(handleMessage)
+	wsServer.SetCallback(router.HandleMessage)
 	wsServer.Start(8080)
 }
 
-func handleMessage(conn wsnet.IConnector, data []byte) {
-	fmt.Printf("%s\n", data)
-	s := "hello client"
-	conn.SendData(unsafe.Slice(unsafe.StringData(s), len(s)))
+func (sysHandler) Echo(conn wsnet.IConnector, req *msgdef.EchoReq) (*msgdef.EchoResp, error) {
+	fmt.Printf("%s\n", req.Text)
+	return &msgdef.EchoResp{Text: "hello client"}, nil
+}
+
+func (sysHandler) Heartbeat(conn wsnet.IConnector, msg *msgdef.HeartbeatNotify) error {
+	return nil
 }
@@ -0,0 +1,4 @@
+// Package msgdef 客户端与服务端共享的消息定义，由 messages.json 生成
+package msgdef
+
+//go:generate go run ../cmd/msggen -schema messages.json -go messages_gen.go -ts ../../../框架/框架/assets/Core/Scripts/Components/NetWork/MsgDefine.ts
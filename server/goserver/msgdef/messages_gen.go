@@ -0,0 +1,53 @@
+// Code generated by msggen from messages.json. DO NOT EDIT.
+
+package msgdef
+
+import "goserver/wsnet"
+
+// 类型ID
+const (
+	TypeSys uint32 = 1
+)
+
+// 消息编号
+const (
+	MsgEcho      uint32 = 1
+	MsgHeartbeat uint32 = 2
+	MsgKick      uint32 = 3
+)
+
+type EchoReq struct {
+	Text string `json:"text" msgpack:"text"`
+}
+
+type EchoResp struct {
+	Text string `json:"text" msgpack:"text"`
+}
+
+type HeartbeatNotify struct {
+	Time int64 `json:"time,string" msgpack:"time"`
+}
+
+type KickPush struct {
+	Code   int32  `json:"code" msgpack:"code"`
+	Reason string `json:"reason" msgpack:"reason"`
+}
+
+// Handlers 客户端消息（request/notify）的处理接口
+type Handlers interface {
+	Echo(conn wsnet.IConnector, req *EchoReq) (*EchoResp, error)
+	Heartbeat(conn wsnet.IConnector, msg *HeartbeatNotify) error
+}
+
+// Register 将 Handlers 注册到路由
+func Register(r *wsnet.Router, h Handlers) {
+	wsnet.Handle(r, TypeSys, MsgEcho, h.Echo)
+	wsnet.Handle(r, TypeSys, MsgHeartbeat, func(conn wsnet.IConnector, msg *HeartbeatNotify) (struct{}, error) {
+		return struct{}{}, h.Heartbeat(conn, msg)
+	})
+}
+
+// PushKick 推送 KickPush
+func PushKick(r *wsnet.Router, conn wsnet.IConnector, msg *KickPush) error {
+	return r.Push(conn, TypeSys, MsgKick, msg)
+}
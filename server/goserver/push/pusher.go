@@ -0,0 +1,192 @@
+// Package push 跨节点推送：玩家连接在任意节点上，都能通过 PushToUser 把消息送达
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"goserver/db"
+	"goserver/wsnet"
+)
+
+// ErrOffline 玩家不在线
+var ErrOffline = errors.New("push: user offline")
+
+// pushMessage 节点间转发的推送消息
+type pushMessage struct {
+	UserID string `json:"uid"`
+	Frame  []byte `json:"frame"`
+}
+
+/*
+Pusher 维护本节点的玩家连接，并通过 Redis 在线状态与节点专属频道把推送转发到玩家所在节点
+
+	pusher := push.New(db.Default(), nodeID)
+	go pusher.Run(ctx)
+	wsServer.SetCloseCallback(func(conn wsnet.IConnector) {
+		pusher.Unbind(context.Background(), conn)
+	})
+	// 登录成功后
+	pusher.Bind(ctx, userID, conn)
+	// 任意节点
+	pusher.PushToUser(ctx, userID, frame)
+*/
+type Pusher struct {
+	store    *db.RedisStore
+	presence *db.Presence
+	prefix   string
+
+	mu    sync.RWMutex
+	conns map[string]wsnet.IConnector // 玩家 ID → 连接
+	users map[wsnet.IConnector]string // 连接 → 玩家 ID，不依赖连接上的数据，连接关闭后仍可解绑
+}
+
+// New 创建推送器，nodeID 在集群内必须唯一
+func New(store *db.RedisStore, nodeID string) *Pusher {
+	p := &Pusher{
+		store:  store,
+		prefix: "push:node:",
+		conns:  make(map[string]wsnet.IConnector),
+		users:  make(map[wsnet.IConnector]string),
+	}
+	// 心跳中断后在线记录可能已被其他节点清理，由 Heartbeat 按本节点的连接重新登记
+	p.presence = store.NewPresence(nodeID, db.PresenceOptions{Users: p.localUsers})
+	return p
+}
+
+// localUsers 本节点已绑定连接的玩家
+func (p *Pusher) localUsers() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	users := make([]string, 0, len(p.conns))
+	for userID := range p.conns {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// Presence 在线状态注册表
+func (p *Pusher) Presence() *db.Presence {
+	return p.presence
+}
+
+func (p *Pusher) channel(nodeID string) string {
+	return p.prefix + nodeID
+}
+
+// Bind 玩家在本节点登录后调用，同一玩家的旧连接会被替换
+func (p *Pusher) Bind(ctx context.Context, userID string, conn wsnet.IConnector) error {
+	p.mu.Lock()
+	if old, ok := p.conns[userID]; ok {
+		delete(p.users, old)
+	}
+	// 同一连接切换账号时解除旧玩家的绑定
+	if prev, ok := p.users[conn]; ok && prev != userID {
+		delete(p.conns, prev)
+	}
+	p.conns[userID] = conn
+	p.users[conn] = userID
+	p.mu.Unlock()
+	return p.presence.Online(ctx, userID)
+}
+
+// Unbind 连接断开时调用，未 Bind 的连接直接忽略
+func (p *Pusher) Unbind(ctx context.Context, conn wsnet.IConnector) error {
+	// 玩家已用新连接重新登录时旧连接已不在 users 中，保留新连接
+	p.mu.Lock()
+	userID, ok := p.users[conn]
+	if !ok {
+		p.mu.Unlock()
+		return nil
+	}
+	delete(p.users, conn)
+	delete(p.conns, userID)
+	p.mu.Unlock()
+	return p.presence.Offline(ctx, userID)
+}
+
+// PushToUser 推送已编码的帧给玩家，玩家在其他节点时经 Redis 转发。玩家不在线返回 ErrOffline
+func (p *Pusher) PushToUser(ctx context.Context, userID string, frame []byte) error {
+	if p.pushLocal(userID, frame) {
+		return nil
+	}
+	nodeID, err := p.presence.Lookup(ctx, userID)
+	if errors.Is(err, db.ErrNotFound) || nodeID == p.presence.NodeID() {
+		return ErrOffline
+	}
+	if err != nil {
+		return err
+	}
+	msg, err := json.Marshal(pushMessage{UserID: userID, Frame: frame})
+	if err != nil {
+		return err
+	}
+	return p.store.Publish(ctx, p.channel(nodeID), string(msg))
+}
+
+func (p *Pusher) pushLocal(userID string, frame []byte) bool {
+	p.mu.RLock()
+	conn, ok := p.conns[userID]
+	p.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	conn.SendData(frame)
+	return true
+}
+
+// Run 维持节点心跳并接收转发到本节点的推送，阻塞直到 ctx 取消，退出前清除本节点的在线记录
+func (p *Pusher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.presence.Run(ctx)
+	}()
+
+	for {
+		err := p.receive(ctx)
+		if ctx.Err() != nil {
+			break
+		}
+		log.Printf("push receive err: %v, resubscribe in 1s", err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+	wg.Wait()
+
+	leaveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.presence.Leave(leaveCtx)
+}
+
+func (p *Pusher) receive(ctx context.Context) error {
+	ps := p.store.Subscribe(ctx, p.channel(p.presence.NodeID()))
+	defer ps.Close()
+	// ReceiveMessage 不响应 ctx 取消，关闭订阅使其返回
+	stop := context.AfterFunc(ctx, func() { ps.Close() })
+	defer stop()
+	if _, err := ps.Receive(ctx); err != nil {
+		return err
+	}
+
+	for {
+		m, err := ps.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		var msg pushMessage
+		if err := json.Unmarshal([]byte(m.Payload), &msg); err != nil {
+			log.Printf("push decode err: %v", err)
+			continue
+		}
+		// 转发途中玩家可能已下线，直接丢弃
+		p.pushLocal(msg.UserID, msg.Frame)
+	}
+}
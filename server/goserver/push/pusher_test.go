@@ -0,0 +1,147 @@
+package push_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"goserver/db"
+	"goserver/db/dbtest"
+	"goserver/push"
+	"goserver/wsnet"
+)
+
+// fakeConn 模拟服务端连接：Close 时清空数据并触发关闭回调
+type fakeConn struct {
+	mu      sync.Mutex
+	data    map[string]any
+	sent    [][]byte
+	onClose func(wsnet.IConnector)
+}
+
+func (c *fakeConn) Put(key string, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = v
+}
+
+func (c *fakeConn) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.data[key]
+	return v, ok
+}
+
+func (c *fakeConn) SendData(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, data)
+}
+
+func (c *fakeConn) Close() {
+	c.mu.Lock()
+	c.data = nil
+	c.mu.Unlock()
+	c.onClose(c)
+}
+
+func newConn(p *push.Pusher) *fakeConn {
+	return &fakeConn{data: make(map[string]any), onClose: func(conn wsnet.IConnector) {
+		if err := p.Unbind(context.Background(), conn); err != nil {
+			panic(err)
+		}
+	}}
+}
+
+func TestUnbindAfterClose(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbtest.NewStore(t)
+	p := push.New(store, "node1")
+
+	conn := newConn(p)
+	if err := p.Bind(ctx, "u1", conn); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PushToUser(ctx, "u1", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.sent) != 1 {
+		t.Fatalf("sent %d frames, want 1", len(conn.sent))
+	}
+
+	conn.Close()
+	if err := p.PushToUser(ctx, "u1", []byte("hi")); !errors.Is(err, push.ErrOffline) {
+		t.Fatalf("PushToUser err = %v, want ErrOffline", err)
+	}
+	if _, err := p.Presence().Lookup(ctx, "u1"); !errors.Is(err, db.ErrNotFound) {
+		t.Fatalf("Lookup err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestRebind 玩家用新连接重新登录后，旧连接关闭不影响新连接
+func TestRebind(t *testing.T) {
+	ctx := context.Background()
+	store, _ := dbtest.NewStore(t)
+	p := push.New(store, "node1")
+
+	old, cur := newConn(p), newConn(p)
+	if err := p.Bind(ctx, "u1", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Bind(ctx, "u1", cur); err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+	if err := p.PushToUser(ctx, "u1", []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if len(cur.sent) != 1 || len(old.sent) != 0 {
+		t.Fatalf("sent old=%d cur=%d, want 0 and 1", len(old.sent), len(cur.sent))
+	}
+}
+
+// TestHeartbeatReregisters 节点心跳中断、在线记录被其他节点清理后，下次心跳重新登记已绑定的玩家
+func TestHeartbeatReregisters(t *testing.T) {
+	ctx := context.Background()
+	store, mr := dbtest.NewStore(t)
+	p := push.New(store, "node1")
+	other := store.NewPresence("node2", db.PresenceOptions{})
+
+	for _, uid := range []string{"u1", "u2"} {
+		if err := p.Bind(ctx, uid, newConn(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Presence().Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// node1 错过心跳，node2 清理它的玩家
+	mr.Del("presence:node:node1")
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		other.Run(runCtx)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for mr.Exists("presence:user:u1") {
+		if time.Now().After(deadline) {
+			t.Fatal("node1 users not swept")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if err := p.Presence().Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, uid := range []string{"u1", "u2"} {
+		if node, err := other.Lookup(ctx, uid); err != nil || node != "node1" {
+			t.Fatalf("Lookup(%s) = %q, %v, want node1", uid, node, err)
+		}
+	}
+}
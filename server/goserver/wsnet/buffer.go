@@ -0,0 +1,178 @@
+package wsnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/rc4"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// maxPooledBuffer 超过该容量的 Buffer 不回收，避免偶发大包长期占用内存
+const maxPooledBuffer = 64 << 10
+
+var secretKey = []byte(SECRET_KEY)
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// GetBuffer 从池中取出一个空的 bytes.Buffer，用完调用 PutBuffer 归还
+func GetBuffer() *bytes.Buffer {
+	return bufferPool.Get().(*bytes.Buffer)
+}
+
+// PutBuffer 归还 Buffer，归还后不可再使用其 Bytes()
+func PutBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	bufferPool.Put(b)
+}
+
+// zlib.Writer 的等级与字典在 Reset 后保留，所以按字典分池，修改等级时清空
+var (
+	zlibWriterMu      sync.RWMutex
+	zlibWriterPools   = make(map[string]*sync.Pool)
+	compressLevel     = zlib.DefaultCompression
+	compressDictLevel = DefaultDictLevel
+)
+
+func zlibWriterPool(dict []byte) *sync.Pool {
+	zlibWriterMu.RLock()
+	p, ok := zlibWriterPools[string(dict)]
+	zlibWriterMu.RUnlock()
+	if ok {
+		return p
+	}
+
+	zlibWriterMu.Lock()
+	defer zlibWriterMu.Unlock()
+	if p, ok = zlibWriterPools[string(dict)]; ok {
+		return p
+	}
+	key, level := string(dict), compressLevel
+	if len(key) > 0 {
+		level = compressDictLevel
+	}
+	p = &sync.Pool{New: func() any {
+		if len(key) == 0 {
+			w, _ := zlib.NewWriterLevel(nil, level)
+			return w
+		}
+		w, _ := zlib.NewWriterLevelDict(nil, level, []byte(key))
+		return w
+	}}
+	zlibWriterPools[key] = p
+	return p
+}
+
+// zlibReader 连同数据源一起池化，解压时不再为 bytes.Reader 分配内存
+type zlibReader struct {
+	src bytes.Reader
+	zr  io.ReadCloser
+}
+
+var zlibReaderPool = sync.Pool{
+	New: func() any { return new(zlibReader) },
+}
+
+func (r *zlibReader) reset(data, dict []byte) error {
+	r.src.Reset(data)
+	if r.zr == nil {
+		zr, err := zlib.NewReaderDict(&r.src, dict)
+		if err != nil {
+			return err
+		}
+		r.zr = zr
+		return nil
+	}
+	return r.zr.(zlib.Resetter).Reset(&r.src, dict)
+}
+
+// AppendCompress 将 data 的 zlib 压缩结果追加到 dst 后返回，dict 为空时不使用预置字典
+func AppendCompress(dst, data, dict []byte) ([]byte, error) {
+	b := GetBuffer()
+	defer PutBuffer(b)
+
+	pool := zlibWriterPool(dict)
+	w := pool.Get().(*zlib.Writer)
+	defer pool.Put(w)
+	w.Reset(b)
+	if _, err := w.Write(data); err != nil {
+		return dst, err
+	}
+	if err := w.Close(); err != nil {
+		return dst, err
+	}
+	return append(dst, b.Bytes()...), nil
+}
+
+// AppendDecompress 将 data 的 zlib 解压结果追加到 dst 后返回，超过 maxDecompressedSize 时返回 ErrTooLarge
+func AppendDecompress(dst, data, dict []byte) ([]byte, error) {
+	r := zlibReaderPool.Get().(*zlibReader)
+	defer zlibReaderPool.Put(r)
+	if err := r.reset(data, dict); err != nil {
+		return dst, err
+	}
+
+	start := len(dst)
+	limit := maxDecompressedSize
+	dst = slices.Grow(dst, 512)
+	for {
+		if len(dst) == cap(dst) {
+			// 借助 append 扩容
+			dst = append(dst, 0)[:len(dst)]
+		}
+		n, err := r.zr.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+n]
+		if limit > 0 && int64(len(dst)-start) > limit {
+			return dst[:start], ErrTooLarge
+		}
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst[:start], err
+		}
+	}
+}
+
+// XORInPlace 原地 XOR 加解密
+func XORInPlace(data, key []byte) {
+	for i := range data {
+		data[i] ^= key[i%len(key)]
+	}
+}
+
+// AppendEncrypt 将 data 按 et 加密后追加到 dst 后返回，XOR/RC4 为对称算法，解密同样使用本函数
+func AppendEncrypt(dst []byte, et EncryptType, data, key []byte) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, data...)
+	if err := encryptInPlace(et, dst[start:], key); err != nil {
+		return dst[:start], err
+	}
+	return dst, nil
+}
+
+func encryptInPlace(et EncryptType, data, key []byte) error {
+	switch et {
+	case ET_NONE:
+		return nil
+	case ET_XOR:
+		XORInPlace(data, key)
+		return nil
+	case ET_RC4:
+		c, err := rc4.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		c.XORKeyStream(data, data)
+		return nil
+	default:
+		return fmt.Errorf("wsnet: unknown encrypt type %d", et)
+	}
+}
@@ -0,0 +1,73 @@
+package wsnet
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 消息负载序列化接口
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSONCodec    Codec = jsonCodec{}
+	ProtoCodec   Codec = protoCodec{}
+	MsgPackCodec Codec = msgpackCodec{}
+)
+
+// ---------------- JSON ----------------
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// ---------------- Protobuf ----------------
+
+// protoCodec 要求消息实现 proto.Message（即 protoc 生成的结构体指针）
+type protoCodec struct{}
+
+func (protoCodec) Name() string { return "protobuf" }
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("wsnet: %T does not implement proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("wsnet: %T does not implement proto.Message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// ---------------- MessagePack ----------------
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,83 @@
+package wsnet
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type codecItem struct {
+	ID    int32  `json:"id" msgpack:"id"`
+	Count int32  `json:"count" msgpack:"count"`
+	Name  string `json:"name" msgpack:"name"`
+}
+
+type codecMsg struct {
+	UserID int64       `json:"userId" msgpack:"userId"`
+	Coins  int64       `json:"coins" msgpack:"coins"`
+	Online bool        `json:"online" msgpack:"online"`
+	Items  []codecItem `json:"items" msgpack:"items"`
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	in := codecMsg{UserID: 1 << 40, Coins: -5, Online: true, Items: []codecItem{{1, 2, "sword"}, {3, 4, "剑"}}}
+	for _, c := range []Codec{JSONCodec, MsgPackCodec} {
+		t.Run(c.Name(), func(t *testing.T) {
+			data, err := c.Marshal(&in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out codecMsg
+			if err := c.Unmarshal(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.UserID != in.UserID || out.Coins != in.Coins || out.Online != in.Online ||
+				len(out.Items) != 2 || out.Items[0] != in.Items[0] || out.Items[1] != in.Items[1] {
+				t.Fatalf("round trip = %+v, want %+v", out, in)
+			}
+		})
+	}
+
+	t.Run(ProtoCodec.Name(), func(t *testing.T) {
+		in, err := structpb.NewStruct(map[string]any{"userId": 1001, "name": "剑", "online": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ProtoCodec.Marshal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := new(structpb.Struct)
+		if err := ProtoCodec.Unmarshal(data, out); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(in, out) {
+			t.Fatalf("round trip = %v, want %v", out, in)
+		}
+
+		// 非 proto.Message 直接报错
+		if _, err := ProtoCodec.Marshal(&codecMsg{}); err == nil {
+			t.Fatal("Marshal of non proto.Message should fail")
+		}
+		if err := ProtoCodec.Unmarshal(data, &codecMsg{}); err == nil {
+			t.Fatal("Unmarshal into non proto.Message should fail")
+		}
+	})
+}
+
+// TestRouterCodec 不同 TypeID 按各自的编解码器收发
+func TestRouterCodec(t *testing.T) {
+	r := NewRouter()
+	r.SetCodec(2, MsgPackCodec)
+	r.SetCodec(3, ProtoCodec)
+	for typeID, want := range map[uint32]Codec{1: JSONCodec, 2: MsgPackCodec, 3: ProtoCodec, 2 | 1<<10: MsgPackCodec} {
+		if got := r.Codec(typeID); got != want {
+			t.Errorf("Codec(%d) = %s, want %s", typeID, got.Name(), want.Name())
+		}
+	}
+	r.SetDefaultCodec(MsgPackCodec)
+	if got := r.Codec(1); got != MsgPackCodec {
+		t.Errorf("Codec(1) = %s after SetDefaultCodec, want msgpack", got.Name())
+	}
+}
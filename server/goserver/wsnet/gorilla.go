@@ -0,0 +1,14 @@
+package wsnet
+
+import "github.com/gorilla/websocket"
+
+// readGorilla 读取一条消息。gorilla 的 SetReadLimit 只限制线上字节数，
+// 开启 permessage-deflate 后解压不受限制，所以解压后的长度同样用 readLimited 检查
+func readGorilla(conn *websocket.Conn) (int, []byte, error) {
+	mt, r, err := conn.NextReader()
+	if err != nil {
+		return mt, nil, err
+	}
+	data, err := readLimited(r)
+	return mt, data, err
+}
@@ -0,0 +1,59 @@
+package wsnet
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestReadGorillaDeflateBomb 线上不足 8KB 的压缩消息解压后超过上限时返回 ErrTooLarge
+func TestReadGorillaDeflateBomb(t *testing.T) {
+	type read struct {
+		data []byte
+		err  error
+	}
+	reads := make(chan read, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		up := websocket.Upgrader{EnableCompression: true}
+		conn, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(8192)
+		for i := 0; i < 2; i++ {
+			_, data, err := readGorilla(conn)
+			reads <- read{data, err}
+		}
+	}))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.EnableWriteCompression(true)
+
+	small := samplePayloads(1)[0]
+	if err := conn.WriteMessage(websocket.BinaryMessage, small); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-reads; got.err != nil || !bytes.Equal(got.data, small) {
+		t.Fatalf("small message: %q, %v", got.data, got.err)
+	}
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 4<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-reads; !errors.Is(got.err, ErrTooLarge) {
+		t.Fatalf("bomb err = %v, want ErrTooLarge", got.err)
+	}
+}
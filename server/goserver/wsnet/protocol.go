@@ -1,10 +1,13 @@
 package wsnet
 
 import (
-	"bytes"
+	"cmp"
 	"compress/zlib"
-	"crypto/rc4"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"slices"
 )
 
 type EncryptType byte
@@ -15,6 +18,7 @@ const (
 	MT_Notify   MessageType = 0x01 // ----001- 客户端发通知，服务端无需返回
 	MT_Response MessageType = 0x02 // ----010- 服务端对 request 的回应
 	MT_Push     MessageType = 0x03 // ----011- 服务端主动推送
+	MT_Error    MessageType = 0x04 // ----100- 服务端对 request 的错误回应，负载见 Error
 )
 
 const (
@@ -27,6 +31,59 @@ const (
 	SECRET_KEY = "asdef123"
 )
 
+// HeaderSize 帧头长度，帧格式为 4 字节大端序头 + 负载（与客户端 WsCoder 一致）
+const HeaderSize = 4
+
+var (
+	ErrShortFrame = errors.New("wsnet: frame shorter than header")
+	ErrTooLarge   = errors.New("wsnet: decompressed payload too large")
+)
+
+// maxDecompressedSize 解压后负载的长度上限，防止解压炸弹
+var maxDecompressedSize int64 = 1 << 20
+
+// SetMaxDecompressedSize 设置解压后负载的长度上限，n <= 0 表示不限制
+func SetMaxDecompressedSize(n int64) {
+	maxDecompressedSize = n
+}
+
+// compressDict 帧负载压缩使用的 zlib 预置字典，为空时使用普通 zlib
+var compressDict []byte
+
+// DefaultDictLevel 预置字典默认使用的压缩等级，低于 7 级时 compress/flate 不使用字典，输出反而比原文大
+const DefaultDictLevel = 7
+
+// SetCompressDict 设置帧负载压缩使用的预置字典及其压缩等级，需在启动前调用，且客户端须使用相同字典。
+// level 为 zlib.DefaultCompression 时使用 DefaultDictLevel；SetCompressLevel 只影响不带字典的压缩
+func SetCompressDict(dict []byte, level int) error {
+	if level == zlib.DefaultCompression {
+		level = DefaultDictLevel
+	}
+	if level < zlib.HuffmanOnly || level > zlib.BestCompression {
+		return fmt.Errorf("wsnet: invalid compress level %d", level)
+	}
+	zlibWriterMu.Lock()
+	defer zlibWriterMu.Unlock()
+	compressDict = dict
+	compressDictLevel = level
+	clear(zlibWriterPools)
+	return nil
+}
+
+// SetCompressLevel 设置不带字典时帧负载的 zlib 压缩等级（zlib.HuffmanOnly ~ zlib.BestCompression），默认 zlib.DefaultCompression。
+// 需在启动前调用
+func SetCompressLevel(level int) error {
+	if level < zlib.HuffmanOnly || level > zlib.BestCompression {
+		return fmt.Errorf("wsnet: invalid compress level %d", level)
+	}
+	zlibWriterMu.Lock()
+	defer zlibWriterMu.Unlock()
+	compressLevel = level
+	// 已池化的 Writer 沿用旧等级，清空后按新等级重建
+	clear(zlibWriterPools)
+	return nil
+}
+
 type MsgPackage struct {
 	MsgType int
 	MsgData []byte
@@ -60,6 +117,50 @@ func DecodeHeader(packageID uint32) MessageID {
 	return msgID
 }
 
+// EncodeFrame 按帧头标识压缩、加密负载，并拼接帧头
+func EncodeFrame(id MessageID, payload []byte) ([]byte, error) {
+	return AppendEncodeFrame(nil, id, payload)
+}
+
+// AppendEncodeFrame 与 EncodeFrame 相同，但将帧追加到 dst 后返回，便于复用缓冲区
+func AppendEncodeFrame(dst []byte, id MessageID, payload []byte) ([]byte, error) {
+	start := len(dst)
+	dst = binary.BigEndian.AppendUint32(dst, EncodeHeader(id))
+	var err error
+	if id.Compress != 0 {
+		if dst, err = AppendCompress(dst, payload, compressDict); err != nil {
+			return dst[:start], err
+		}
+	} else {
+		dst = append(dst, payload...)
+	}
+	if err = encryptInPlace(EncryptType(id.EncType), dst[start+HeaderSize:], secretKey); err != nil {
+		return dst[:start], err
+	}
+	return dst, nil
+}
+
+// DecodeFrame 解析帧头，并按帧头标识解密、解压负载。
+// 负载在 frame 上原地解密，未压缩时返回的负载与 frame 共用内存
+func DecodeFrame(frame []byte) (MessageID, []byte, error) {
+	if len(frame) < HeaderSize {
+		return MessageID{}, nil, ErrShortFrame
+	}
+	id := DecodeHeader(binary.BigEndian.Uint32(frame))
+	payload := frame[HeaderSize:]
+	// XOR/RC4 均为对称算法，解密即再加密一次
+	if err := encryptInPlace(EncryptType(id.EncType), payload, secretKey); err != nil {
+		return id, nil, err
+	}
+	if id.Compress != 0 {
+		var err error
+		if payload, err = AppendDecompress(nil, payload, compressDict); err != nil {
+			return id, nil, err
+		}
+	}
+	return id, payload, nil
+}
+
 /*
 key := []byte("my-secret-key")
 plain := []byte("hello world")
@@ -68,9 +169,8 @@ decrypted := XOREncrypt(encrypted, key) // 再次 XOR = 原文
 */
 func XOREncrypt(data, key []byte) []byte {
 	out := make([]byte, len(data))
-	for i := range data {
-		out[i] = data[i] ^ key[i%len(key)]
-	}
+	copy(out, data)
+	XORInPlace(out, key)
 	return out
 }
 
@@ -81,34 +181,114 @@ encrypted, _ := RC4Encrypt(key, plain) // 加密数据
 decrypted, _ := RC4Encrypt(key, encrypted) // RC4 解密与加密相同
 */
 func RC4Encrypt(data, key []byte) ([]byte, error) {
-	c, err := rc4.NewCipher(key)
+	out, err := AppendEncrypt(make([]byte, 0, len(data)), ET_RC4, data, key)
 	if err != nil {
 		return nil, err
 	}
-	dst := make([]byte, len(data))
-	c.XORKeyStream(dst, data)
-	return dst, nil
+	return out, nil
 }
 
 // zlib压缩
 func Compress(data []byte) ([]byte, error) {
-	var b bytes.Buffer
-	w := zlib.NewWriter(&b)
-	_, err := w.Write(data)
-	if err != nil {
-		return nil, err
-	}
-	w.Close()
-	return b.Bytes(), nil
+	return AppendCompress(nil, data, nil)
 }
 
 // zlib解压缩
 func Decompress(data []byte) ([]byte, error) {
-	b := bytes.NewReader(data)
-	r, err := zlib.NewReader(b)
+	return AppendDecompress(nil, data, nil)
+}
+
+// readLimited 读取全部数据，超过 maxDecompressedSize 时返回 ErrTooLarge
+func readLimited(r io.Reader) ([]byte, error) {
+	limit := maxDecompressedSize
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
 	if err != nil {
 		return nil, err
 	}
-	defer r.Close()
-	return io.ReadAll(r)
+	if int64(len(data)) > limit {
+		return nil, ErrTooLarge
+	}
+	return data, nil
+}
+
+// CompressDict 使用预置字典的 zlib 压缩，小而结构相似的 JSON 负载压缩率明显更好
+func CompressDict(data, dict []byte) ([]byte, error) {
+	return AppendCompress(nil, data, dict)
+}
+
+// DecompressDict 使用预置字典的 zlib 解压缩
+func DecompressDict(data, dict []byte) ([]byte, error) {
+	return AppendDecompress(nil, data, dict)
+}
+
+// BuildDict 从样本流量生成预置字典，size 为字典长度上限（zlib 窗口为 32KB）。
+// 按片段出现频率给每条样本打分，优先收录最有代表性的完整样本
+func BuildDict(samples [][]byte, size int) []byte {
+	counts := make(map[string]int)
+	for _, sample := range samples {
+		for _, tok := range splitTokens(sample) {
+			counts[tok]++
+		}
+	}
+
+	type entry struct {
+		sample []byte
+		score  float64
+	}
+	seen := make(map[string]bool)
+	entries := make([]entry, 0, len(samples))
+	for _, sample := range samples {
+		if len(sample) == 0 || seen[string(sample)] {
+			continue
+		}
+		seen[string(sample)] = true
+		var weight int
+		for _, tok := range splitTokens(sample) {
+			// 只出现一次的片段对其他消息没有收益
+			if n := counts[tok]; n > 1 {
+				weight += n * len(tok)
+			}
+		}
+		entries = append(entries, entry{sample, float64(weight) / float64(len(sample))})
+	}
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return cmp.Compare(b.score, a.score)
+	})
+
+	picked := make([][]byte, 0, len(entries))
+	total := 0
+	for _, e := range entries {
+		if total+len(e.sample) > size {
+			continue
+		}
+		picked = append(picked, e.sample)
+		total += len(e.sample)
+	}
+
+	// 字典末尾的内容匹配距离最近，得分最高的样本放在最后
+	dict := make([]byte, 0, total)
+	for i := len(picked) - 1; i >= 0; i-- {
+		dict = append(dict, picked[i]...)
+	}
+	return dict
+}
+
+// splitTokens 按 JSON 分隔符切分，分隔符保留在片段末尾，如 {"id":1} -> {, "id":, 1}
+func splitTokens(data []byte) []string {
+	var toks []string
+	start := 0
+	for i, c := range data {
+		switch c {
+		case '{', '}', '[', ']', ',', ':':
+			toks = append(toks, string(data[start:i+1]))
+			start = i + 1
+		}
+	}
+	if start < len(data) {
+		toks = append(toks, string(data[start:]))
+	}
+	return toks
 }
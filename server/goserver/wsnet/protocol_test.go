@@ -0,0 +1,300 @@
+package wsnet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// samplePayloads 模拟线上常见的小 JSON 负载
+func samplePayloads(n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = []byte(fmt.Sprintf(
+			`{"userId":%d,"name":"player%d","level":%d,"coins":%d,"items":[{"id":%d,"count":%d}],"online":true}`,
+			100000+i, i, i%60, i*37, i%200, i%9))
+	}
+	return out
+}
+
+func TestCompressDictRoundTrip(t *testing.T) {
+	samples := samplePayloads(200)
+	dict := BuildDict(samples, 4096)
+	if len(dict) == 0 || len(dict) > 4096 {
+		t.Fatalf("dict size = %d", len(dict))
+	}
+	for _, in := range samples[:20] {
+		c, err := CompressDict(in, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := DecompressDict(c, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(in, out) {
+			t.Fatalf("round trip mismatch: %s != %s", out, in)
+		}
+	}
+}
+
+// TestCompressDictRatio 默认等级下带字典的压缩输出明显小于原文
+func TestCompressDictRatio(t *testing.T) {
+	samples := samplePayloads(200)
+	dict := BuildDict(samples[:100], 4096)
+	var raw, withDict int
+	for _, in := range samples[100:] {
+		d, err := CompressDict(in, dict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw += len(in)
+		withDict += len(d)
+	}
+	if ratio := float64(withDict) / float64(raw); ratio >= 0.5 {
+		t.Fatalf("dict compressed %d bytes from %d, ratio %.3f, want below 0.5", withDict, raw, ratio)
+	}
+}
+
+// TestSetCompressDict 帧按字典压缩，对端使用同一字典解压
+func TestSetCompressDict(t *testing.T) {
+	samples := samplePayloads(200)
+	dict := BuildDict(samples[:100], 4096)
+	if err := SetCompressDict(dict, zlib.DefaultCompression); err != nil {
+		t.Fatal(err)
+	}
+	defer SetCompressDict(nil, zlib.DefaultCompression)
+	if compressDictLevel != DefaultDictLevel {
+		t.Fatalf("dict level = %d, want %d", compressDictLevel, DefaultDictLevel)
+	}
+
+	in := samples[150]
+	frame, err := EncodeFrame(MessageID{MsgType: uint32(MT_Push), Compress: 1}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frame)-HeaderSize >= len(in) {
+		t.Fatalf("frame payload %d bytes, want smaller than %d", len(frame)-HeaderSize, len(in))
+	}
+	_, out, err := DecodeFrame(frame)
+	if err != nil || !bytes.Equal(out, in) {
+		t.Fatalf("round trip = %q, %v", out, err)
+	}
+	if err := SetCompressDict(dict, 10); err == nil {
+		t.Fatal("level 10 should be rejected")
+	}
+}
+
+func TestCompressLevel(t *testing.T) {
+	defer SetCompressLevel(zlib.DefaultCompression)
+	in := bytes.Repeat(samplePayloads(1)[0], 20)
+	sizes := make(map[int]int)
+	for _, level := range []int{zlib.NoCompression, zlib.BestCompression} {
+		if err := SetCompressLevel(level); err != nil {
+			t.Fatal(err)
+		}
+		c, err := Compress(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Decompress(c)
+		if err != nil || !bytes.Equal(out, in) {
+			t.Fatalf("level %d round trip failed: %v", level, err)
+		}
+		sizes[level] = len(c)
+	}
+	if sizes[zlib.BestCompression] >= sizes[zlib.NoCompression] {
+		t.Fatalf("sizes = %v, level not applied", sizes)
+	}
+	if err := SetCompressLevel(10); err == nil {
+		t.Fatal("level 10 should be rejected")
+	}
+}
+
+func benchmarkCompress(b *testing.B, compress func([]byte) ([]byte, error)) {
+	samples := samplePayloads(256)
+	var in, out int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := samples[i%len(samples)]
+		c, err := compress(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		in += len(p)
+		out += len(c)
+	}
+	b.ReportMetric(float64(out)/float64(in), "ratio")
+}
+
+func benchmarkDecompress(b *testing.B, compress, decompress func([]byte) ([]byte, error)) {
+	samples := samplePayloads(256)
+	compressed := make([][]byte, len(samples))
+	for i, p := range samples {
+		c, err := compress(p)
+		if err != nil {
+			b.Fatal(err)
+		}
+		compressed[i] = c
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := decompress(compressed[i%len(compressed)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCompress(b *testing.B) {
+	benchmarkCompress(b, Compress)
+}
+
+func BenchmarkCompressDict(b *testing.B) {
+	dict := BuildDict(samplePayloads(1024), 4096)
+	benchmarkCompress(b, func(p []byte) ([]byte, error) { return CompressDict(p, dict) })
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	benchmarkDecompress(b, Compress, Decompress)
+}
+
+func BenchmarkDecompressDict(b *testing.B) {
+	dict := BuildDict(samplePayloads(1024), 4096)
+	benchmarkDecompress(b,
+		func(p []byte) ([]byte, error) { return CompressDict(p, dict) },
+		func(p []byte) ([]byte, error) { return DecompressDict(p, dict) })
+}
+
+func TestDecompressBomb(t *testing.T) {
+	bomb, err := Compress(make([]byte, 64<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decompress(bomb); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Decompress err = %v, want ErrTooLarge", err)
+	}
+
+	frame, err := EncodeFrame(MessageID{Compress: 1}, make([]byte, 64<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := DecodeFrame(frame); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("DecodeFrame err = %v, want ErrTooLarge", err)
+	}
+}
+
+func FuzzDecompress(f *testing.F) {
+	for _, p := range samplePayloads(4) {
+		c, _ := Compress(p)
+		f.Add(c)
+	}
+	bomb, _ := Compress(make([]byte, 4<<20))
+	f.Add(bomb)
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		out, err := Decompress(data)
+		if err != nil {
+			return
+		}
+		if int64(len(out)) > maxDecompressedSize {
+			t.Fatalf("decompressed %d bytes, limit %d", len(out), maxDecompressedSize)
+		}
+		// 合法输入再压缩一次应当能还原
+		c, err := Compress(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := Decompress(c)
+		if err != nil || !bytes.Equal(again, out) {
+			t.Fatalf("round trip mismatch: %v", err)
+		}
+	})
+}
+
+func FuzzDecodeHeader(f *testing.F) {
+	f.Add(uint32(0))
+	f.Add(uint32(0xFFFFFFFF))
+	f.Add(EncodeHeader(MessageID{MsgType: uint32(MT_Push), Compress: 1, EncType: uint32(ET_RC4), TypeID: 1023, MsgID: 8191}))
+
+	f.Fuzz(func(t *testing.T, header uint32) {
+		id := DecodeHeader(header)
+		if id.MsgType > 0x0F || id.Compress > 0x01 || id.EncType > 0x0F || id.TypeID > 0x3FF || id.MsgID > 0x1FFF {
+			t.Fatalf("field out of range: %+v", id)
+		}
+		if got := EncodeHeader(id); got != header {
+			t.Fatalf("EncodeHeader(DecodeHeader(%#x)) = %#x", header, got)
+		}
+	})
+}
+
+func BenchmarkXOREncrypt(b *testing.B) {
+	p := samplePayloads(1)[0]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = XOREncrypt(p, secretKey)
+	}
+}
+
+func BenchmarkXORInPlace(b *testing.B) {
+	p := samplePayloads(1)[0]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		XORInPlace(p, secretKey)
+	}
+}
+
+func benchmarkFrames(b *testing.B, id MessageID) {
+	samples := samplePayloads(256)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendEncodeFrame(buf[:0], id, samples[i%len(samples)]); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err = DecodeFrame(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// 以下基准的 allocs/op 即每帧（编码 + 解码）的分配次数，乘以 10000 即 10k msgs/sec 下每秒的分配次数
+func BenchmarkFrameXOR(b *testing.B) {
+	benchmarkFrames(b, MessageID{EncType: uint32(ET_XOR), TypeID: 1, MsgID: 1})
+}
+
+func BenchmarkFrameRC4(b *testing.B) {
+	benchmarkFrames(b, MessageID{EncType: uint32(ET_RC4), TypeID: 1, MsgID: 1})
+}
+
+func BenchmarkFrameCompressXOR(b *testing.B) {
+	benchmarkFrames(b, MessageID{Compress: 1, EncType: uint32(ET_XOR), TypeID: 1, MsgID: 1})
+}
+
+func BenchmarkFrameCompressXORParallel(b *testing.B) {
+	samples := samplePayloads(256)
+	id := MessageID{Compress: 1, EncType: uint32(ET_XOR), TypeID: 1, MsgID: 1}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		var buf []byte
+		i := 0
+		for pb.Next() {
+			var err error
+			if buf, err = AppendEncodeFrame(buf[:0], id, samples[i%len(samples)]); err != nil {
+				b.Error(err)
+				return
+			}
+			if _, _, err = DecodeFrame(buf); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
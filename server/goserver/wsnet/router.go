@@ -0,0 +1,189 @@
+package wsnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// 框架使用的错误码，业务错误码由处理函数通过 *Error 自定义，建议从 100 开始
+const (
+	CodeInternal   int32 = 1 // 处理函数返回了非 *Error 的错误
+	CodeBadRequest int32 = 2 // 请求负载反序列化失败
+	CodeNotFound   int32 = 3 // 没有对应的处理函数
+)
+
+// Error 请求失败时以 MT_Error 回给客户端的错误。
+// 负载固定为 JSON，与 TypeID 使用的编解码器无关，便于客户端统一解析
+type Error struct {
+	Code int32  `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func NewError(code int32, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("wsnet: error %d: %s", e.Code, e.Msg)
+}
+
+type handlerFunc func(conn IConnector, id MessageID, payload []byte)
+
+// Router 按 TypeID/MsgID 分发消息，并按 TypeID 选择负载编解码器
+type Router struct {
+	mu       sync.RWMutex
+	codecs   map[uint32]Codec
+	handlers map[uint32]handlerFunc
+	// 未设置编解码器的 TypeID 使用默认编解码器
+	defaultCodec Codec
+}
+
+func NewRouter() *Router {
+	return &Router{
+		codecs:       make(map[uint32]Codec),
+		handlers:     make(map[uint32]handlerFunc),
+		defaultCodec: JSONCodec,
+	}
+}
+
+// SetDefaultCodec 设置默认编解码器
+func (r *Router) SetDefaultCodec(c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultCodec = c
+}
+
+// SetCodec 为某个 TypeID 指定编解码器
+func (r *Router) SetCodec(typeID uint32, c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[typeID&0x3FF] = c
+}
+
+// Codec 返回 TypeID 对应的编解码器
+func (r *Router) Codec(typeID uint32) Codec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.codecs[typeID&0x3FF]; ok {
+		return c
+	}
+	return r.defaultCodec
+}
+
+func routeKey(typeID, msgID uint32) uint32 {
+	return (typeID&0x3FF)<<13 | msgID&0x1FFF
+}
+
+func (r *Router) handle(typeID, msgID uint32, h handlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[routeKey(typeID, msgID)] = h
+}
+
+// HandleMessage 解析帧并分发给已注册的处理函数，可直接作为 HandleCallback 使用
+func (r *Router) HandleMessage(conn IConnector, data []byte) {
+	id, payload, err := DecodeFrame(data)
+	if err != nil {
+		log.Printf("decode frame err: %v", err)
+		// 解压炸弹直接断开
+		if errors.Is(err, ErrTooLarge) {
+			conn.Close()
+		}
+		return
+	}
+
+	r.mu.RLock()
+	h, ok := r.handlers[routeKey(id.TypeID, id.MsgID)]
+	r.mu.RUnlock()
+	if !ok {
+		log.Printf("no handler for type %d msg %d", id.TypeID, id.MsgID)
+		r.replyError(conn, id, NewError(CodeNotFound, "no handler"))
+		return
+	}
+	h(conn, id, payload)
+}
+
+// replyError 请求失败时回 MT_Error，避免客户端等到超时，或把后续回应错配给这个请求。
+// 非 *Error 的错误只回 CodeInternal，不把内部错误信息暴露给客户端
+func (r *Router) replyError(conn IConnector, id MessageID, err error) {
+	if MessageType(id.MsgType) != MT_Request {
+		return
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		e = NewError(CodeInternal, "internal error")
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("marshal error response err: %v", err)
+		return
+	}
+	id.MsgType = uint32(MT_Error)
+	frame, err := EncodeFrame(id, payload)
+	if err != nil {
+		log.Printf("encode error response type %d msg %d err: %v", id.TypeID, id.MsgID, err)
+		return
+	}
+	conn.SendData(frame)
+}
+
+// Send 序列化消息并以 id 指定的帧头发送
+func (r *Router) Send(conn IConnector, id MessageID, v any) error {
+	payload, err := r.Codec(id.TypeID).Marshal(v)
+	if err != nil {
+		return err
+	}
+	frame, err := EncodeFrame(id, payload)
+	if err != nil {
+		return err
+	}
+	conn.SendData(frame)
+	return nil
+}
+
+// Push 服务端主动推送
+func (r *Router) Push(conn IConnector, typeID, msgID uint32, v any) error {
+	return r.Send(conn, MessageID{MsgType: uint32(MT_Push), TypeID: typeID, MsgID: msgID}, v)
+}
+
+/*
+Handle 注册类型化的处理函数，请求负载自动反序列化为 *T，
+MT_Request 消息的返回值 R 自动序列化后以 MT_Response 回给客户端（压缩/加密方式与请求一致），
+MT_Notify 消息的返回值被忽略。
+MT_Request 消息反序列化失败或 fn 返回错误时回 MT_Error，fn 可返回 *Error 指定错误码。
+
+	wsnet.Handle(router, 1, 1, func(conn wsnet.IConnector, req *LoginReq) (*LoginResp, error) {
+		return &LoginResp{Token: "xxx"}, nil
+	})
+*/
+func Handle[T any, R any](r *Router, typeID, msgID uint32, fn func(IConnector, *T) (R, error)) {
+	r.handle(typeID, msgID, func(conn IConnector, id MessageID, payload []byte) {
+		codec := r.Codec(id.TypeID)
+		req := new(T)
+		if err := codec.Unmarshal(payload, req); err != nil {
+			log.Printf("unmarshal type %d msg %d err: %v", id.TypeID, id.MsgID, err)
+			r.replyError(conn, id, NewError(CodeBadRequest, "bad request"))
+			return
+		}
+
+		resp, err := fn(conn, req)
+		if err != nil {
+			log.Printf("handle type %d msg %d err: %v", id.TypeID, id.MsgID, err)
+			r.replyError(conn, id, err)
+			return
+		}
+		if MessageType(id.MsgType) != MT_Request {
+			return
+		}
+
+		respID := id
+		respID.MsgType = uint32(MT_Response)
+		if err := r.Send(conn, respID, resp); err != nil {
+			log.Printf("send response type %d msg %d err: %v", id.TypeID, id.MsgID, err)
+			r.replyError(conn, id, err)
+		}
+	})
+}
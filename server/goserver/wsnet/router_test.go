@@ -0,0 +1,157 @@
+package wsnet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeConn 记录 Router 发出的帧
+type fakeConn struct {
+	mu     sync.Mutex
+	data   map[string]any
+	frames [][]byte
+	closed bool
+}
+
+func (c *fakeConn) Put(key string, v any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		c.data = make(map[string]any)
+	}
+	c.data[key] = v
+}
+
+func (c *fakeConn) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.data[key]
+	return v, ok
+}
+
+func (c *fakeConn) SendData(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.frames = append(c.frames, append([]byte(nil), data...))
+}
+
+func (c *fakeConn) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+type echoReq struct {
+	Text string `json:"text"`
+}
+
+type echoResp struct {
+	Text string `json:"text"`
+}
+
+func testFrame(t *testing.T, mt MessageType, typeID, msgID uint32, payload string) []byte {
+	t.Helper()
+	frame, err := EncodeFrame(MessageID{MsgType: uint32(mt), EncType: uint32(ET_XOR), Compress: 1, TypeID: typeID, MsgID: msgID}, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+// noReply 表示不应有回应帧
+const noReply MessageType = 0xFF
+
+func TestRouterDispatch(t *testing.T) {
+	const (
+		msgEcho = 1
+		msgFail = 2
+		msgNone = 3
+	)
+	newRouter := func(calls *int) *Router {
+		r := NewRouter()
+		Handle(r, 1, msgEcho, func(conn IConnector, req *echoReq) (*echoResp, error) {
+			*calls++
+			return &echoResp{Text: "re:" + req.Text}, nil
+		})
+		Handle(r, 1, msgFail, func(conn IConnector, req *echoReq) (*echoResp, error) {
+			*calls++
+			if req.Text == "biz" {
+				return nil, NewError(100, "not enough coins")
+			}
+			return nil, errors.New("db down")
+		})
+		return r
+	}
+
+	tests := []struct {
+		name      string
+		frame     func(t *testing.T) []byte
+		wantCalls int
+		wantType  MessageType
+		wantBody  string
+	}{
+		{"Request", func(t *testing.T) []byte { return testFrame(t, MT_Request, 1, msgEcho, `{"text":"hi"}`) },
+			1, MT_Response, `{"text":"re:hi"}`},
+		{"Notify", func(t *testing.T) []byte { return testFrame(t, MT_Notify, 1, msgEcho, `{"text":"hi"}`) },
+			1, noReply, ""},
+		{"UnknownRoute", func(t *testing.T) []byte { return testFrame(t, MT_Request, 1, msgNone, `{}`) },
+			0, MT_Error, `{"code":3,"msg":"no handler"}`},
+		{"UnknownRouteNotify", func(t *testing.T) []byte { return testFrame(t, MT_Notify, 9, 9, `{}`) },
+			0, noReply, ""},
+		{"DecodeError", func(t *testing.T) []byte { return testFrame(t, MT_Request, 1, msgEcho, `{"text":`) },
+			0, MT_Error, `{"code":2,"msg":"bad request"}`},
+		{"HandlerError", func(t *testing.T) []byte { return testFrame(t, MT_Request, 1, msgFail, `{"text":"biz"}`) },
+			1, MT_Error, `{"code":100,"msg":"not enough coins"}`},
+		// 内部错误不回传错误内容
+		{"InternalError", func(t *testing.T) []byte { return testFrame(t, MT_Request, 1, msgFail, `{"text":"x"}`) },
+			1, MT_Error, `{"code":1,"msg":"internal error"}`},
+		{"NotifyError", func(t *testing.T) []byte { return testFrame(t, MT_Notify, 1, msgFail, `{"text":"x"}`) },
+			1, noReply, ""},
+		{"BadFrame", func(t *testing.T) []byte { return []byte{1, 2} },
+			0, noReply, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			r := newRouter(&calls)
+			conn := &fakeConn{}
+			r.HandleMessage(conn, tt.frame(t))
+
+			if calls != tt.wantCalls {
+				t.Fatalf("handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantType == noReply {
+				if len(conn.frames) != 0 {
+					t.Fatalf("sent %d frames, want none", len(conn.frames))
+				}
+				return
+			}
+			if len(conn.frames) != 1 {
+				t.Fatalf("sent %d frames, want 1", len(conn.frames))
+			}
+			id, payload, err := DecodeFrame(conn.frames[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 回应沿用请求的路由、压缩与加密方式
+			if MessageType(id.MsgType) != tt.wantType || id.TypeID != 1 || id.Compress != 1 || EncryptType(id.EncType) != ET_XOR {
+				t.Fatalf("reply id = %+v", id)
+			}
+			if string(payload) != tt.wantBody {
+				t.Fatalf("reply = %s, want %s", payload, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestRouterTooLarge 解压炸弹断开连接
+func TestRouterTooLarge(t *testing.T) {
+	defer SetMaxDecompressedSize(maxDecompressedSize)
+	SetMaxDecompressedSize(16)
+	conn := &fakeConn{}
+	NewRouter().HandleMessage(conn, testFrame(t, MT_Request, 1, 1, `{"text":"longer than sixteen bytes"}`))
+	if !conn.closed {
+		t.Fatal("conn not closed")
+	}
+}
@@ -12,11 +12,16 @@ type IConnector interface {
 type IWsServer interface {
 	Start(port int)
 	SetCallback(cb HandleCallback)
+	SetCloseCallback(cb CloseCallback)
+	EnableCompression(level int)
 	Close()
 }
 
 type HandleCallback func(conn IConnector, data []byte)
 
+// CloseCallback 连接断开时回调，每个连接只回调一次
+type CloseCallback func(conn IConnector)
+
 var (
 	pongWait     = 30 * time.Second // 读取超时时间
 	pingPeriod   = 10 * time.Second // 发送 ping 间隔
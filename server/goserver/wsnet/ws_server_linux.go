@@ -1,7 +1,11 @@
 package wsnet
 
 import (
+	"bytes"
+	"compress/flate"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"sync"
@@ -9,6 +13,7 @@ import (
 	"time"
 
 	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsflate"
 	"github.com/gobwas/ws/wsutil"
 	"github.com/mailru/easygo/netpoll"
 )
@@ -20,6 +25,22 @@ type WsConnector struct {
 	LastPing time.Time
 	data     map[string]any
 	Mutex    sync.Mutex
+	// writeMu 保证一帧的头部与负载连续写出，推送、请求回应与控制帧回应来自不同协程
+	writeMu sync.Mutex
+	// 握手时协商成功 permessage-deflate 才不为空
+	deflate *wsflate.Helper
+	// 所属服务端，Close 经它移除连接并回调 OnClose
+	server *WsServer
+	closed atomic.Bool
+}
+
+func newWsConnector(conn net.Conn, connID int64) *WsConnector {
+	return &WsConnector{
+		Conn:     conn,
+		ConnId:   connID,
+		LastPing: time.Now(),
+		data:     make(map[string]any),
+	}
 }
 
 func (c *WsConnector) Put(key string, v any) {
@@ -40,13 +61,86 @@ func (c *WsConnector) SendData(data []byte) {
 	c.LastPing = time.Now()
 	c.Mutex.Unlock()
 
-	err := wsutil.WriteServerBinary(c.Conn, data)
+	c.writeMu.Lock()
+	var err error
+	if c.deflate != nil {
+		err = c.writeCompressed(data)
+	} else {
+		err = wsutil.WriteServerBinary(c.Conn, data)
+	}
+	c.writeMu.Unlock()
 	if err != nil {
 		log.Printf("SendData err: %v", err)
 		_ = c.Conn.Close()
 	}
 }
 
+// writeCompressed 调用方须持有 writeMu
+func (c *WsConnector) writeCompressed(data []byte) error {
+	f, err := c.deflate.CompressFrame(ws.NewBinaryFrame(data))
+	if err != nil {
+		return err
+	}
+	return ws.WriteFrame(c.Conn, f)
+}
+
+// readData 读取一条二进制消息，协商了 permessage-deflate 时自动解压。
+// 无论是否压缩，消息长度超过 maxDecompressedSize 时都返回 ErrTooLarge
+func (c *WsConnector) readData() ([]byte, error) {
+	var msg wsflate.MessageState
+	rd := wsutil.Reader{
+		Source:         c.Conn,
+		State:          ws.StateServerSide,
+		OnIntermediate: c.handleControl,
+	}
+	if c.deflate != nil {
+		rd.State |= ws.StateExtended
+		rd.Extensions = []wsutil.RecvExtension{&msg}
+	}
+	for {
+		hdr, err := rd.NextFrame()
+		if err != nil {
+			return nil, err
+		}
+		if hdr.OpCode.IsControl() {
+			if err := c.handleControl(hdr, &rd); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if hdr.OpCode != ws.OpBinary {
+			if err := rd.Discard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if !msg.IsCompressed() {
+			return readLimited(&rd)
+		}
+		return readLimited(wsflate.NewReader(&rd, c.deflate.Decompressor))
+	}
+}
+
+// handleControl 处理 ping/close 控制帧。回应先写入缓冲，再在 writeMu 内一次写出，避免与 SendData 的帧交错
+func (c *WsConnector) handleControl(hdr ws.Header, r io.Reader) error {
+	var buf bytes.Buffer
+	err := wsutil.ControlHandler{
+		Src:                 r,
+		Dst:                 &buf,
+		State:               ws.StateServerSide,
+		DisableSrcCiphering: true,
+	}.Handle(hdr)
+	if buf.Len() > 0 {
+		c.writeMu.Lock()
+		_, werr := c.Conn.Write(buf.Bytes())
+		c.writeMu.Unlock()
+		if err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
 func (c *WsConnector) UpdatePing() {
 	c.Mutex.Lock()
 	defer c.Mutex.Unlock()
@@ -59,18 +153,23 @@ func (c *WsConnector) IsAlive(timeout time.Duration) bool {
 	return time.Since(c.LastPing) <= timeout
 }
 
+// Close 关闭连接并从服务端移除，立即回调 OnClose。Put 的数据保留，供 OnClose 回调读取
 func (g *WsConnector) Close() {
-	g.Lock()
-	defer g.Unlock()
+	if g.server != nil {
+		g.server.removeClient(g)
+		return
+	}
 	g.Conn.Close()
-	g.data = make(map[string]any)
 }
 
 type WsServer struct {
 	Mutex    sync.RWMutex
 	Clients  map[int64]*WsConnector
 	Callback HandleCallback
+	OnClose  CloseCallback
 	nextID   int64
+	// 开启 permessage-deflate 后不为空
+	deflate *wsflate.Helper
 }
 
 func NewWsServer() *WsServer {
@@ -99,21 +198,28 @@ func (s *WsServer) Start(port int) {
 		}
 
 		go func(conn net.Conn) {
-			_, err := ws.Upgrade(conn)
+			var ext *wsflate.Extension
+			upgrader := ws.Upgrader{}
+			if s.deflate != nil {
+				ext = &wsflate.Extension{Parameters: wsflate.DefaultParameters}
+				upgrader.Negotiate = ext.Negotiate
+			}
+			_, err := upgrader.Upgrade(conn)
 			if err != nil {
 				_ = conn.Close()
 				return
 			}
 
-			connID := atomic.AddInt64(&s.nextID, 1)
-			c := &WsConnector{
-				Conn:     conn,
-				ConnId:   connID,
-				LastPing: time.Now(),
+			c := newWsConnector(conn, atomic.AddInt64(&s.nextID, 1))
+			c.server = s
+			if ext != nil {
+				if _, ok := ext.Accepted(); ok {
+					c.deflate = s.deflate
+				}
 			}
 
 			s.Mutex.Lock()
-			s.Clients[connID] = c
+			s.Clients[c.ConnId] = c
 			s.Mutex.Unlock()
 
 			conn.SetReadDeadline(time.Now().Add(35 * time.Second))
@@ -124,8 +230,11 @@ func (s *WsServer) Start(port int) {
 					return
 				}
 
-				data, err := wsutil.ReadClientBinary(conn)
+				data, err := c.readData()
 				if err != nil {
+					if errors.Is(err, ErrTooLarge) {
+						log.Printf("client %d sent oversized message, disconnected", c.ConnId)
+					}
 					s.removeClient(c)
 					return
 				}
@@ -134,6 +243,10 @@ func (s *WsServer) Start(port int) {
 				if s.Callback != nil {
 					s.Callback(c, data)
 				}
+				// 回调中已关闭的连接不再订阅，避免 fd 被新连接复用后误操作
+				if c.closed.Load() {
+					return
+				}
 				// 继续订阅读事件
 				poller.Resume(desc)
 			})
@@ -147,15 +260,46 @@ func (s *WsServer) Start(port int) {
 
 func (s *WsServer) removeClient(c *WsConnector) {
 	s.Mutex.Lock()
-	defer s.Mutex.Unlock()
+	_, ok := s.Clients[c.ConnId]
+	c.closed.Store(true)
 	_ = c.Conn.Close()
 	delete(s.Clients, c.ConnId)
+	s.Mutex.Unlock()
+
+	if ok && s.OnClose != nil {
+		s.OnClose(c)
+	}
+}
+
+// EnableCompression 开启 permessage-deflate 协商，level 为 compress/flate 压缩等级，需在 Start 前调用
+func (s *WsServer) EnableCompression(level int) {
+	s.deflate = newDeflateHelper(level)
+}
+
+// newDeflateHelper 协商参数为 wsflate.DefaultParameters（no context takeover），每条消息独立压缩
+func newDeflateHelper(level int) *wsflate.Helper {
+	return &wsflate.Helper{
+		Compressor: func(w io.Writer) wsflate.Compressor {
+			f, err := flate.NewWriter(w, level)
+			if err != nil {
+				f, _ = flate.NewWriter(w, flate.DefaultCompression)
+			}
+			return f
+		},
+		Decompressor: func(r io.Reader) wsflate.Decompressor {
+			return flate.NewReader(r)
+		},
+	}
 }
 
 func (s *WsServer) SetCallback(cb HandleCallback) {
 	s.Callback = cb
 }
 
+func (s *WsServer) SetCloseCallback(cb CloseCallback) {
+	s.OnClose = cb
+}
+
 func (s *WsServer) StartHeartbeat(timeout time.Duration) {
 	ticker := time.NewTicker(timeout / 2)
 	go func() {
@@ -176,9 +320,15 @@ func (s *WsServer) StartHeartbeat(timeout time.Duration) {
 	}()
 }
 
+// Close 关闭所有连接，每个连接触发一次 OnClose
 func (s *WsServer) Close() {
-	for _, v := range s.Clients {
-		v.Close()
+	s.Mutex.RLock()
+	clients := make([]*WsConnector, 0, len(s.Clients))
+	for _, c := range s.Clients {
+		clients = append(clients, c)
+	}
+	s.Mutex.RUnlock()
+	for _, c := range clients {
+		s.removeClient(c)
 	}
-	clear(s.Clients)
 }
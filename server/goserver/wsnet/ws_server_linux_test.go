@@ -0,0 +1,171 @@
+package wsnet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestWsServerClose(t *testing.T) {
+	s := NewWsServer()
+	closed := make(map[int64]int)
+	s.SetCloseCallback(func(conn IConnector) {
+		c := conn.(*WsConnector)
+		// 关闭后仍能读取连接上的数据
+		if v, ok := c.Get("uid"); !ok || v != c.ConnId {
+			t.Errorf("conn %d data lost after close: %v", c.ConnId, v)
+		}
+		closed[c.ConnId]++
+	})
+
+	for id := int64(1); id <= 3; id++ {
+		server, client := net.Pipe()
+		defer client.Close()
+		c := newWsConnector(server, id)
+		c.Put("uid", id)
+		s.Clients[id] = c
+	}
+	s.Close()
+	s.Close()
+
+	if len(closed) != 3 {
+		t.Fatalf("OnClose called for %d conns, want 3", len(closed))
+	}
+	for id, n := range closed {
+		if n != 1 {
+			t.Fatalf("conn %d OnClose called %d times", id, n)
+		}
+	}
+	if len(s.Clients) != 0 {
+		t.Fatalf("%d clients left", len(s.Clients))
+	}
+}
+
+// TestWsConnectorClose Close 经服务端移除连接并立即回调 OnClose
+func TestWsConnectorClose(t *testing.T) {
+	s := NewWsServer()
+	closed := 0
+	s.SetCloseCallback(func(IConnector) { closed++ })
+	server, client := net.Pipe()
+	defer client.Close()
+	c := newWsConnector(server, 1)
+	c.server = s
+	s.Clients[c.ConnId] = c
+
+	c.Close()
+	c.Close()
+	if closed != 1 {
+		t.Fatalf("OnClose called %d times, want 1", closed)
+	}
+	if len(s.Clients) != 0 {
+		t.Fatalf("%d clients left", len(s.Clients))
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("conn not closed")
+	}
+}
+
+// TestReadDataTooLarge 未压缩的超长消息同样返回 ErrTooLarge
+func TestReadDataTooLarge(t *testing.T) {
+	defer SetMaxDecompressedSize(maxDecompressedSize)
+	SetMaxDecompressedSize(1024)
+
+	tests := []struct {
+		name    string
+		size    int
+		wantErr error
+	}{
+		{"WithinLimit", 1024, nil},
+		{"TooLarge", 4 << 20, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go wsutil.WriteClientBinary(client, make([]byte, tt.size))
+
+			c := newWsConnector(server, 1)
+			data, err := c.readData()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && len(data) != tt.size {
+				t.Fatalf("read %d bytes, want %d", len(data), tt.size)
+			}
+		})
+	}
+}
+
+// yieldConn 每次写之前让出调度，放大并发写交错的概率
+type yieldConn struct {
+	net.Conn
+}
+
+func (c yieldConn) Write(p []byte) (int, error) {
+	runtime.Gosched()
+	return c.Conn.Write(p)
+}
+
+// TestSendDataConcurrent 推送与请求回应在不同协程同时写出、同时回应 ping，客户端收到的每一帧都完整
+func TestSendDataConcurrent(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := newWsConnector(yieldConn{server}, 1)
+	defer c.Close()
+
+	const perWriter = 200
+	// 每条消息以发送方与序号开头，其余字节与发送方相同，交错写出时无法通过校验
+	msg := func(writer byte, i int) []byte {
+		data := bytes.Repeat([]byte{writer}, 2048)
+		data[1], data[2] = byte(i>>8), byte(i)
+		return data
+	}
+
+	// 服务端读协程只会收到 ping，回应 pong
+	go func() {
+		for {
+			if _, err := c.readData(); err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for i := 0; i < perWriter; i++ {
+			if err := wsutil.WriteClientMessage(client, ws.OpPing, []byte("ping")); err != nil {
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	writers := []byte{'p', 'q', 'r', 's'}
+	for _, writer := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				c.SendData(msg(writer, i))
+			}
+		}()
+	}
+
+	next := map[byte]int{}
+	for n := 0; n < len(writers)*perWriter; n++ {
+		data, err := wsutil.ReadServerBinary(client)
+		if err != nil {
+			t.Fatalf("read frame %d: %v", n, err)
+		}
+		writer := data[0]
+		if want := msg(writer, next[writer]); !bytes.Equal(data, want) {
+			t.Fatalf("frame %d corrupted or out of order from %q", n, writer)
+		}
+		next[writer]++
+	}
+	wg.Wait()
+}
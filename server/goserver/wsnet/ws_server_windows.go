@@ -1,7 +1,9 @@
 package wsnet
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"sync"
 	"sync/atomic"
@@ -41,22 +43,23 @@ func (g *WsConnector) SendData(data []byte) {
 	}
 }
 
+// Close 关闭连接，Put 的数据保留，供 OnClose 回调读取
 func (g *WsConnector) Close() {
-	g.Lock()
-	defer g.Unlock()
 	g.Conn.Close()
-	g.data = make(map[string]any)
 }
 
 func (g *WsConnector) ReadMessage(server *WsServer) {
 	for {
-		_, message, err := g.Conn.ReadMessage()
+		_, message, err := readGorilla(g.Conn)
 		if err != nil {
-			fmt.Println("Read error:", err)
-			g.Conn.Close()
-			server.Mutex.Lock()
-			delete(server.Clients, g.ConnId)
-			server.Mutex.Unlock()
+			if errors.Is(err, ErrTooLarge) {
+				log.Printf("client %d sent oversized message, disconnected", g.ConnId)
+				g.Conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseMessageTooBig, ""), time.Now().Add(time.Second))
+			} else {
+				fmt.Println("Read error:", err)
+			}
+			server.removeClient(g)
 			break
 		}
 		g.Conn.SetWriteDeadline(time.Now().Add(pongWait))
@@ -70,10 +73,7 @@ func (g *WsConnector) WriteMessage(server *WsServer) {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
 		ticker.Stop()
-		g.Conn.Close()
-		server.Mutex.Lock()
-		delete(server.Clients, g.ConnId)
-		server.Mutex.Unlock()
+		server.removeClient(g)
 	}()
 	for {
 		select {
@@ -99,7 +99,10 @@ type WsServer struct {
 	Mutex    sync.RWMutex
 	Clients  map[int64]*WsConnector
 	Callback HandleCallback
+	OnClose  CloseCallback
 	nextID   int64
+	// permessage-deflate 压缩等级，nil 表示不开启
+	compressLevel *int
 }
 
 func NewWsServer() *WsServer {
@@ -120,19 +123,28 @@ var upgrader = websocket.Upgrader{
 func (g *WsServer) Start(port int) {
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		// 升级连接为 WebSocket
-		connect, err := upgrader.Upgrade(w, r, nil)
+		up := upgrader
+		up.EnableCompression = g.compressLevel != nil
+		connect, err := up.Upgrade(w, r, nil)
 		if err != nil {
 			fmt.Println("Upgrade error:", err)
 			return
 		}
-		connID := atomic.AddInt64(&g.nextID, 1)
+		if g.compressLevel != nil {
+			// 未协商成功时以下调用无效果
+			connect.EnableWriteCompression(true)
+			if err := connect.SetCompressionLevel(*g.compressLevel); err != nil {
+				fmt.Println("SetCompressionLevel error:", err)
+			}
+		}
 		connector := &WsConnector{
 			Conn:     connect,
-			ConnId:   connID,
+			ConnId:   atomic.AddInt64(&g.nextID, 1),
 			SendChan: make(chan []byte, 4096),
+			data:     make(map[string]any),
 		}
 		g.Mutex.Lock()
-		g.Clients[connID] = connector
+		g.Clients[connector.ConnId] = connector
 		g.Mutex.Unlock()
 		connect.SetReadLimit(8192)
 		connect.SetReadDeadline(time.Now().Add(pongWait))
@@ -155,13 +167,41 @@ func (g *WsServer) Start(port int) {
 	http.ListenAndServe(fmt.Sprintf(":%v", port), nil)
 }
 
+// EnableCompression 开启 permessage-deflate 协商，level 为 compress/flate 压缩等级，需在 Start 前调用
+func (g *WsServer) EnableCompression(level int) {
+	g.compressLevel = &level
+}
+
 func (g *WsServer) SetCallback(cb HandleCallback) {
 	g.Callback = cb
 }
 
+func (g *WsServer) SetCloseCallback(cb CloseCallback) {
+	g.OnClose = cb
+}
+
+// removeClient 读写协程都会调用，只有第一次调用触发 OnClose
+func (g *WsServer) removeClient(c *WsConnector) {
+	g.Mutex.Lock()
+	_, ok := g.Clients[c.ConnId]
+	c.Conn.Close()
+	delete(g.Clients, c.ConnId)
+	g.Mutex.Unlock()
+
+	if ok && g.OnClose != nil {
+		g.OnClose(c)
+	}
+}
+
+// Close 关闭所有连接，每个连接触发一次 OnClose
 func (g *WsServer) Close() {
-	for _, v := range g.Clients {
-		v.Close()
+	g.Mutex.RLock()
+	clients := make([]*WsConnector, 0, len(g.Clients))
+	for _, c := range g.Clients {
+		clients = append(clients, c)
+	}
+	g.Mutex.RUnlock()
+	for _, c := range clients {
+		g.removeClient(c)
 	}
-	clear(g.Clients)
 }
@@ -0,0 +1,63 @@
+// 本文件由 msggen 根据 messages.json 生成，请勿手动修改
+
+import { Message, MsgType, WsCoder } from './WsCoder';
+
+/** 类型ID */
+export const TypeID = {
+    Sys: 1,
+} as const;
+
+/** 消息编号 */
+export const MsgID = {
+    Echo: 1,
+    Heartbeat: 2,
+    Kick: 3,
+} as const;
+
+export interface EchoReq {
+    text: string;
+}
+
+export interface EchoResp {
+    text: string;
+}
+
+export interface HeartbeatNotify {
+    time: string;
+}
+
+export interface KickPush {
+    code: number;
+    reason: string;
+}
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+function encodeJson(msgType: MsgType, typeID: number, msgID: number, body: object): Message {
+    return new Message(WsCoder.encodeHeader(msgType, typeID, msgID), textEncoder.encode(JSON.stringify(body)));
+}
+
+function decodeJson<T>(data: Uint8Array): T {
+    return JSON.parse(textDecoder.decode(data)) as T;
+}
+
+/** 编码 EchoReq，返回的消息可直接交给 Ws.sendBuffer(msg.cmd, msg.data) */
+export function encodeEchoReq(msg: EchoReq): Message {
+    return encodeJson(MsgType.Request, TypeID.Sys, MsgID.Echo, msg);
+}
+
+/** 解码 EchoResp */
+export function decodeEchoResp(data: Uint8Array): EchoResp {
+    return decodeJson<EchoResp>(data);
+}
+
+/** 编码 HeartbeatNotify，返回的消息可直接交给 Ws.sendBuffer(msg.cmd, msg.data) */
+export function encodeHeartbeatNotify(msg: HeartbeatNotify): Message {
+    return encodeJson(MsgType.Notify, TypeID.Sys, MsgID.Heartbeat, msg);
+}
+
+/** 解码 KickPush */
+export function decodeKickPush(data: Uint8Array): KickPush {
+    return decodeJson<KickPush>(data);
+}
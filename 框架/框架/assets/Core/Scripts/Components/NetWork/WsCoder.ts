@@ -1,6 +1,20 @@
 import { CryptUtil } from '../../Tools/CryptUtil';
 import { logMgr } from '../../Managers/LogMgr';
 
+/** 消息类型（与服务端 wsnet.MessageType 一致） */
+export enum MsgType {
+    /** 客户端发请求，服务端需要返回 */
+    Request = 0x00,
+    /** 客户端发通知，服务端无需返回 */
+    Notify = 0x01,
+    /** 服务端对 request 的回应 */
+    Response = 0x02,
+    /** 服务端主动推送 */
+    Push = 0x03,
+    /** 服务端对 request 的错误回应，负载为 JSON {"code": number, "msg": string} */
+    Error = 0x04,
+}
+
 /** 消息结构 */
 export class Message {
     constructor(public cmd: number, public data: Uint8Array) {}
@@ -54,6 +68,39 @@ export class WsCoder {
         return new Message(cmd, data);
     }
 
+    /**
+     * 组装消息头（与服务端 wsnet.EncodeHeader 一致）
+     * @param msgType 消息类型（0 ~ 15）
+     * @param typeID 类型ID（0 ~ 1023）
+     * @param msgID 消息编号（0 ~ 8191）
+     * @param compress 压缩标识（0 或 1）
+     * @param encType 加密类型（0 ~ 15）
+     * @returns 消息头
+     */
+    public static encodeHeader(msgType: number, typeID: number, msgID: number, compress: number = 0, encType: number = 0): number {
+        let cmd = msgType & 0x0f;
+        cmd |= (compress & 0x01) << 4;
+        cmd |= (encType & 0x0f) << 5;
+        cmd |= (typeID & 0x3ff) << 9;
+        cmd |= (msgID & 0x1fff) << 19;
+        return cmd >>> 0;
+    }
+
+    /**
+     * 解析消息头（与服务端 wsnet.DecodeHeader 一致）
+     * @param cmd 消息头
+     * @returns 各字段
+     */
+    public static decodeHeader(cmd: number): { msgType: number; compress: number; encType: number; typeID: number; msgID: number } {
+        return {
+            msgType: cmd & 0x0f,
+            compress: (cmd >>> 4) & 0x01,
+            encType: (cmd >>> 5) & 0x0f,
+            typeID: (cmd >>> 9) & 0x3ff,
+            msgID: (cmd >>> 19) & 0x1fff,
+        };
+    }
+
     /**
      * 通过 DataView 设置 Uint32 值（大端序）
      * @param buffer 目标缓冲区